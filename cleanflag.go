@@ -0,0 +1,46 @@
+package closer
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// MarkCleanShutdown sets the file that flags a clean shutdown for the next start of the app, the classic way
+// to decide whether to run a recovery. The file is removed right away and gets written at the very end of
+// the shutdown, along with the exit reason file, provided the shutdown was clean: caused by a signal or Close
+// and exiting with ExitCodeOK. So check WasCleanShutdown before marking. A failure to write the file is logged,
+// the one to remove it is returned, a missing file is no failure.
+func MarkCleanShutdown(path string) error {
+	return std().MarkCleanShutdown(path)
+}
+
+// MarkCleanShutdown is the same as the package-level MarkCleanShutdown but for this closer.
+func (c *Closer) MarkCleanShutdown(path string) error {
+	if err := removeFile(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	c.mux.Lock()
+	c.cleanFile = path
+	c.mux.Unlock()
+	return nil
+}
+
+// WasCleanShutdown reports whether the last shutdown of the app was clean, i.e. the file set via MarkCleanShutdown
+// exists. It's false if the file can't be accessed for any reason, as on the first run ever.
+func WasCleanShutdown(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func (c *Closer) writeCleanFlag(cause ShutdownCause, code int) {
+	c.mux.Lock()
+	path, ok := c.cleanFile, c.codeOK
+	c.mux.Unlock()
+	if len(path) == 0 || code != ok || (cause != CauseSignal && cause != CauseClose) {
+		return
+	}
+	if err := writeFile(path, nil, 0644); err != nil {
+		c.log(LevelWarn, "clean_flag_error", "failed to write the clean shutdown flag: "+err.Error(), "path", path, "error", err)
+	}
+}
@@ -0,0 +1,487 @@
+package closer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type cleanup struct {
+	name      string
+	dependsOn string
+	// signal is set for the callbacks bound to a specific signal
+	signal os.Signal
+	handle *Handle
+	// parent is set for the callbacks bound via BindChild
+	parent *Handle
+	// seq is the registration sequence number, see Config.CleanupOrder
+	seq uint64
+	fn  func(ctx context.Context, sig os.Signal) error
+}
+
+// plain adapts the callback without arguments to the cleanup.fn signature.
+func plain(fn func()) func(context.Context, os.Signal) error {
+	return func(context.Context, os.Signal) error {
+		fn()
+		return nil
+	}
+}
+
+// Handle refers to a cleanup callback bound via BindNamed or BindChild.
+type Handle struct {
+	owner    *Closer
+	name     string
+	label    atomic.Pointer[string]
+	disabled atomic.Bool
+}
+
+// Name returns the name the callback was bound with.
+func (h *Handle) Name() string {
+	return h.name
+}
+
+// SetLabel sets the label of the callback, a low-cardinality tag (e.g. "db" for several database-related
+// cleanups) that goes along with the name as a dimension for metrics and tracing, while the logs still
+// show the specific name.
+func (h *Handle) SetLabel(label string) *Handle {
+	h.label.Store(&label)
+	return h
+}
+
+// Label returns the label of the callback, that's the name unless set via SetLabel.
+func (h *Handle) Label() string {
+	if label := h.label.Load(); label != nil {
+		return *label
+	}
+	return h.name
+}
+
+// Enable makes the callback run at shutdown, that's the default.
+func (h *Handle) Enable() {
+	h.disabled.Store(false)
+}
+
+// Disable makes the callback be skipped at shutdown, unless it's enabled back before.
+func (h *Handle) Disable() {
+	h.disabled.Store(true)
+}
+
+// Enabled tells if the callback is going to be called at shutdown.
+func (h *Handle) Enabled() bool {
+	return !h.disabled.Load()
+}
+
+// panicError is the error a panic in a callback is returned as.
+type panicError struct {
+	name  string
+	value interface{}
+	stack []StackFrame
+}
+
+func (e *panicError) Error() string {
+	if len(e.name) > 0 {
+		return fmt.Sprintf("cleanup %s panic: %v", e.name, e.value)
+	}
+	return fmt.Sprintf("cleanup panic: %v", e.value)
+}
+
+// call calls the callback, a panic is recovered and returned as an error.
+func (cb cleanup) call(ctx context.Context, sig os.Signal) (err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			err = &panicError{name: cb.name, value: x, stack: panicStack(3)}
+		}
+	}()
+	if err := cb.fn(ctx, sig); err != nil {
+		if len(cb.name) > 0 {
+			return fmt.Errorf("cleanup %s failed: %w", cb.name, err)
+		}
+		return fmt.Errorf("cleanup failed: %w", err)
+	}
+	return nil
+}
+
+// enterCallbacks marks the closer as running the callbacks of the shutdown or of a reload until leave
+// is called, see inCallback.
+func (c *Closer) enterCallbacks() (leave func()) {
+	c.callbacks.Add(1)
+	return func() {
+		c.callbacks.Add(-1)
+	}
+}
+
+// inCallback reports whether the closer is running the callbacks marked by enterCallbacks. A close request
+// made meanwhile mustn't wait for the shutdown, as it may come from one of the callbacks the shutdown
+// waits for in turn; the callback running is tracked by c.current.
+func (c *Closer) inCallback() bool {
+	return c.callbacks.Load() > 0
+}
+
+// label returns the label of the callback, see Handle.Label.
+func (cb cleanup) label() string {
+	if cb.handle != nil {
+		return cb.handle.Label()
+	}
+	return cb.name
+}
+
+// callLogged calls the callback, its error or a recovered panic is logged.
+func (cb cleanup) callLogged(c *Closer, ctx context.Context, sig os.Signal) error {
+	err := cb.call(ctx, sig)
+	if err != nil {
+		c.log(LevelError, "cleanup_error", err.Error(), "callback", cb.name, "label", cb.label(), "error", err)
+	}
+	return err
+}
+
+// callHook calls the hook, a recovered panic is logged and returned.
+func (c *Closer) callHook(name string, fn func()) error {
+	return cleanup{name: name, fn: plain(fn)}.callLogged(c, context.Background(), nil)
+}
+
+// runCleanups calls the bound callbacks in order, it returns how many callbacks were called
+// and the aggregated error of the failed ones. The caller must hold c.sem.
+func (c *Closer) runCleanups(ctx context.Context) (ran int, err error) {
+	sig := c.receivedSignal()
+	var errs []error
+	list := c.sortedCleanups()
+	total := 0
+	for _, cb := range list {
+		if cb.handle == nil || cb.handle.Enabled() {
+			total++
+		}
+	}
+	c.total.Store(int32(total))
+	c.mux.Lock()
+	c.running = list
+	c.mux.Unlock()
+	defer c.current.Store(nil)
+	for i, cb := range list {
+		c.position.Store(int32(i))
+		if cb.handle != nil && !cb.handle.Enabled() {
+			c.log(LevelInfo, "cleanup_skipped", "cleanup "+cb.name+" skipped", "callback", cb.name, "label", cb.label())
+			continue
+		}
+		c.current.Store(&cb.name)
+		if err := cb.callLogged(c, ctx, sig); err != nil {
+			var p *panicError
+			if errors.As(err, &p) {
+				c.cleanupPanicked.Store(true)
+				c.runPanicHooks(p.value, p.stack)
+			}
+			c.recordErr(err)
+			errs = append(errs, err)
+		}
+		ran++
+		c.ran.Add(1)
+	}
+	// the closers not driven by the cleanups (see Chain) follow
+	if c.root {
+		if err := ShutdownAll(context.Background()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return ran, cleanupFailed(errs)
+}
+
+// cleanupFailed aggregates the errors of the callbacks, wrapping ErrCleanupFailed. It's nil if there are none.
+func cleanupFailed(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return cleanupError{errors.Join(errs...)}
+}
+
+// cleanupError is the aggregated error of the callbacks, its message is that of the errors alone
+// as they tell the cleanup has failed already.
+type cleanupError struct {
+	err error
+}
+
+func (e cleanupError) Error() string {
+	return e.err.Error()
+}
+
+func (e cleanupError) Unwrap() []error {
+	return []error{ErrCleanupFailed, e.err}
+}
+
+// runCleanupsTimeout is runCleanups bounded by the shutdown timeout, if any. If the timeout elapses,
+// it returns what's been done so far, leaving the remaining callbacks running in the background.
+// The signals received meanwhile are handled as per SignalDuringCleanup, exit tells if the shutdown
+// is going to exit the process. The caller must hold c.sem.
+func (c *Closer) runCleanupsTimeout(exit bool) (ran int, err error, timedOut bool) {
+	// the context of the callbacks is done as the timeout elapses or as accelerated by a signal
+	var ctx context.Context = c.valuesContext()
+	if c.timeout > 0 {
+		ctx = budgetContext{Context: ctx, deadline: c.clock.Now().Add(c.timeout)}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		ran int
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer c.enterCallbacks()()
+		ran, err := c.runCleanups(ctx)
+		done <- result{ran, err}
+	}()
+	var expired, halfway <-chan time.Time
+	if c.timeout > 0 {
+		timer := c.clock.NewTimer(c.timeout)
+		defer timer.Stop()
+		expired = timer.C()
+		if c.onHalfway != nil {
+			half := c.clock.NewTimer(c.timeout / 2)
+			defer half.Stop()
+			halfway = half.C()
+		}
+	}
+	// the signals are received to keep track of the ignored ones too
+	signals := c.signalChan
+	for {
+		select {
+		case res := <-done:
+			return res.ran, res.err, false
+		case sig := <-signals:
+			if c.sigPolicy == IgnoreDuringCleanup || c.isReloadSignal(sig) {
+				c.countIgnored(sig)
+				continue
+			}
+			c.countSignal(sig)
+			if c.sigPolicy == ForceExit && exit && c.strategy == ExitOS {
+				c.log(LevelWarn, "cleanup_signal", "signal "+SignalName(sig)+" received during cleanup, exiting",
+					"signal", SignalName(sig), "policy", "force_exit")
+				c.runAlways()
+				// the exit is left to the shutdown, which still writes out the outcome
+				c.forced.Store(true)
+				return int(c.ran.Load()), c.firstErr(), false
+			}
+			c.log(LevelWarn, "cleanup_signal", "signal "+SignalName(sig)+" received during cleanup, accelerating",
+				"signal", SignalName(sig), "policy", "accelerate")
+			cancel()
+			// the next signals are left unread
+			signals = nil
+			continue
+		case <-halfway:
+			onHalfway, remaining := c.onHalfway, int(c.total.Load()-c.ran.Load())
+			c.callHook("OnHalfwayTimeout", func() { onHalfway(remaining) })
+			halfway = nil
+			continue
+		case <-expired:
+		}
+		break
+	}
+	stuck, stuckLabel, skipped := c.recordSkipped()
+	switch {
+	case len(stuck) > 0:
+		err = fmt.Errorf("%w after %v, stuck in cleanup %q, unfinished: %s", ErrShutdownTimeout, c.timeout, stuck,
+			strings.Join(skipped, ", "))
+	case len(skipped) > 0:
+		err = fmt.Errorf("%w after %v, unfinished: %s", ErrShutdownTimeout, c.timeout, strings.Join(skipped, ", "))
+	default:
+		err = fmt.Errorf("%w after %v", ErrShutdownTimeout, c.timeout)
+	}
+	c.log(LevelError, "timeout", err.Error(), "timeout", c.timeout, "stuck", stuck, "label", stuckLabel, "skipped", skipped)
+	c.recordErr(err)
+	if c.dump {
+		buf := make([]byte, c.dumpSize)
+		buf = buf[:runtime.Stack(buf, true)]
+		c.stackWriter().Write(buf)
+	}
+	return int(c.ran.Load()), err, true
+}
+
+// recordSkipped records the callbacks that haven't finished, see SkippedCleanups. It also returns
+// the one that is still running, if any, along with its label.
+func (c *Closer) recordSkipped() (stuck, stuckLabel string, skipped []string) {
+	inProgress := c.current.Load() != nil
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.skipped = nil
+	for i := int(c.position.Load()); i < len(c.running); i++ {
+		cb := c.running[i]
+		if cb.handle != nil && !cb.handle.Enabled() {
+			continue
+		}
+		name := cb.name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if inProgress && len(c.skipped) == 0 {
+			stuck, stuckLabel = name, cb.label()
+		}
+		c.skipped = append(c.skipped, name)
+	}
+	return stuck, stuckLabel, c.skipped
+}
+
+// budgetContext reports the deadline of the shutdown timeout, it's done by the cancellation as the timeout
+// elapses (as measured by the clock of the closer).
+type budgetContext struct {
+	context.Context
+	deadline time.Time
+}
+
+func (b budgetContext) Deadline() (time.Time, bool) {
+	return b.deadline, true
+}
+
+// reportProgress logs the progress of the cleanups every ProgressInterval until stop is called.
+func (c *Closer) reportProgress() (stop func()) {
+	if c.progress <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			timer := c.clock.NewTimer(c.progress)
+			select {
+			case <-done:
+				timer.Stop()
+				return
+			case <-timer.C():
+			}
+			ran, total := c.ran.Load(), c.total.Load()
+			msg := fmt.Sprintf("still shutting down, %d/%d cleanups done", ran, total)
+			var current string
+			if name := c.current.Load(); name != nil && len(*name) > 0 {
+				current = *name
+				msg += ", current: " + current
+			}
+			c.log(LevelWarn, "progress", msg, "done", ran, "total", total, "current", current)
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// activeCleanups returns the bound callbacks that apply to the shutdown,
+// skipping the ones bound to a signal other than the received one. The caller must hold c.sem.
+func (c *Closer) activeCleanups() []cleanup {
+	sig, failed := c.trigger()
+	if len(c.cleanups) == 0 {
+		return nil
+	}
+	list := make([]cleanup, 0, len(c.cleanups))
+	for _, cb := range c.cleanups {
+		if c.applies(cb, sig, failed) {
+			list = append(list, cb)
+		}
+	}
+	return list
+}
+
+// applies tells if the callback applies to the shutdown caused by the signal (nil if not a signal),
+// all of them do if the shutdown has failed (an error or a panic).
+func (c *Closer) applies(cb cleanup, sig os.Signal, failed bool) bool {
+	return cb.signal == nil || cb.signal == sig || (c.fold && sig != nil) || failed
+}
+
+// hasSignalCleanups tells if there are callbacks bound to the signal. The caller must hold c.sem.
+func (c *Closer) hasSignalCleanups(sig os.Signal) bool {
+	for _, cb := range c.cleanups {
+		if cb.signal == sig {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedCleanups returns the bound callbacks in the order they should be called, so every callback
+// bound via BindAfter goes after the callbacks it depends on and every parent (see BindChild) goes
+// after its children. The caller must hold c.sem.
+func (c *Closer) sortedCleanups() []cleanup {
+	return c.sortCleanups(c.activeCleanups())
+}
+
+// sortCleanups orders the callbacks as described by sortedCleanups, by CleanupOrder otherwise.
+func (c *Closer) sortCleanups(list []cleanup) []cleanup {
+	list = append([]cleanup(nil), list...)
+	if len(list) < 2 {
+		// the common case of a CLI, there's nothing to order
+		return list
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if c.order == FIFO {
+			return list[i].seq < list[j].seq
+		}
+		return list[i].seq > list[j].seq
+	})
+	// callbacks by name and by parent
+	named := make(map[string][]int)
+	children := make(map[*Handle][]int)
+	for i, cb := range list {
+		if len(cb.name) > 0 {
+			named[cb.name] = append(named[cb.name], i)
+		}
+		if cb.parent != nil {
+			children[cb.parent] = append(children[cb.parent], i)
+		}
+	}
+	done := make([]bool, len(list))
+	ready := func(i int) bool {
+		for _, j := range named[list[i].dependsOn] {
+			if j != i && !done[j] {
+				return false
+			}
+		}
+		if list[i].handle == nil {
+			return true
+		}
+		for _, j := range children[list[i].handle] {
+			if !done[j] {
+				return false
+			}
+		}
+		return true
+	}
+	sorted := make([]cleanup, 0, len(list))
+	for len(sorted) < len(list) {
+		// pick the first callback that has all its dependencies done
+		next := -1
+		for i := range list {
+			if !done[i] && ready(i) {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			break
+		}
+		done[next] = true
+		sorted = append(sorted, list[next])
+	}
+	if len(sorted) == len(list) {
+		return sorted
+	}
+	// the rest is a cycle (or depends on one), use the registration order
+	rest := make([]cleanup, 0, len(list)-len(sorted))
+	for i := range list {
+		if !done[i] {
+			rest = append(rest, list[i])
+		}
+	}
+	sort.SliceStable(rest, func(i, j int) bool {
+		return rest[i].seq < rest[j].seq
+	})
+	var cycle []string
+	for _, cb := range rest {
+		cycle = append(cycle, cb.name)
+		sorted = append(sorted, cb)
+	}
+	c.log(LevelWarn, "cleanup_cycle", "dependency cycle between cleanups: "+strings.Join(cycle, ", "), "callbacks", cycle)
+	return sorted
+}
@@ -0,0 +1,110 @@
+package closer
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestOneThenManyCleanups(t *testing.T) {
+	c, codes := newTestCloser(t, Config{})
+	var order []int
+	c.Bind(func() { order = append(order, 1) })
+	if got := len(c.sortedCleanups()); got != 1 {
+		t.Fatalf("%d cleanups, want 1", got)
+	}
+	c.Bind(func() { order = append(order, 2) })
+	c.Bind(func() { order = append(order, 3) })
+	go c.Close()
+	waitExit(t, codes)
+	if want := []int{3, 2, 1}; !reflect.DeepEqual(order, want) {
+		t.Errorf("order %v, want %v", order, want)
+	}
+}
+
+func BenchmarkSortCleanups(b *testing.B) {
+	for _, n := range []int{0, 1, 2, 100} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			c := newCloser(Config{}, false, false)
+			for i := 0; i < n; i++ {
+				c.Bind(func() {})
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				c.sem.Lock()
+				c.sortedCleanups()
+				c.sem.Unlock()
+			}
+		})
+	}
+}
+
+// names returns the names of the sorted cleanups.
+func names(list []cleanup) []string {
+	var out []string
+	for _, cb := range list {
+		out = append(out, cb.name)
+	}
+	return out
+}
+
+func TestSortCleanupsChain(t *testing.T) {
+	c, _ := newTestCloser(t, Config{})
+	// bound in the reverse order of the chain, which LIFO alone would keep
+	c.BindAfter("c", "b", func() {})
+	c.BindAfter("b", "a", func() {})
+	c.BindAfter("a", "", func() {})
+	c.BindAfter("x", "missing", func() {})
+	c.sem.Lock()
+	got := names(c.sortedCleanups())
+	c.sem.Unlock()
+	if want := []string{"x", "a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("order %v, want %v", got, want)
+	}
+}
+
+func TestSortCleanupsCycle(t *testing.T) {
+	c, _ := newTestCloser(t, Config{})
+	var logged []string
+	c.SetLogFunc(func(level, msg string, kv ...interface{}) {
+		if level == LevelWarn {
+			logged = append(logged, msg)
+		}
+	})
+	c.BindAfter("free", "", func() {})
+	c.BindAfter("a", "b", func() {})
+	c.BindAfter("b", "a", func() {})
+	c.BindAfter("after", "a", func() {})
+	c.sem.Lock()
+	got := names(c.sortedCleanups())
+	c.sem.Unlock()
+	// the cycle and what depends on it come last, in the registration order
+	if want := []string{"free", "a", "b", "after"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("order %v, want %v", got, want)
+	}
+	if len(logged) != 1 {
+		t.Errorf("warnings %q, want the cycle", logged)
+	}
+}
+
+func TestBindChildTree(t *testing.T) {
+	c, codes := newTestCloser(t, Config{})
+	var order []string
+	record := func(name string) func() {
+		return func() { order = append(order, name) }
+	}
+	root := c.BindNamed("root", record("root"))
+	db := c.BindChild(root, record("db"))
+	c.BindChild(db, record("db.conn1"))
+	c.BindChild(db, record("db.conn2"))
+	c.BindChild(root, record("cache"))
+	c.Bind(record("other"))
+	go c.Close()
+	waitExit(t, codes)
+	// leaves first, the siblings in the reverse order of Bind
+	want := []string{"other", "cache", "db.conn2", "db.conn1", "db", "root"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("order %v, want %v", order, want)
+	}
+}
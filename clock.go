@@ -0,0 +1,45 @@
+package closer
+
+import "time"
+
+// Clock abstracts the time functions the closer relies on, so the tests can drive the time of the timeouts,
+// MinShutdownTime and the other time-based features instead of sleeping, see SetClock.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is the subset of time.Timer used by the closer.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// SetClock replaces the clock of the closer, the time package by default. It must be called before
+// the closer is in use, e.g. right after NewCloser in a test.
+func (c *Closer) SetClock(clk Clock) {
+	c.clock = clk
+}
+
+// realClock is the clock backed by the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	t *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t realTimer) Stop() bool {
+	return t.t.Stop()
+}
@@ -0,0 +1,244 @@
+package closer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeClock is the clock the tests advance by hand, its timers fire as the time passes their deadline.
+type fakeClock struct {
+	mux    sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+	// created receives as a timer is created, so the tests know the time may be advanced
+	created chan struct{}
+}
+
+type fakeTimer struct {
+	deadline time.Time
+	c        chan time.Time
+	stopped  bool
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{
+		now:     time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		created: make(chan struct{}, 16),
+	}
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) NewTimer(d time.Duration) Timer {
+	f.mux.Lock()
+	t := &fakeTimer{deadline: f.now.Add(d), c: make(chan time.Time, 1)}
+	f.timers = append(f.timers, t)
+	f.mux.Unlock()
+	select {
+	case f.created <- struct{}{}:
+	default:
+	}
+	return fakeTimerOf{f, t}
+}
+
+// Advance moves the time forward, firing the timers that are due.
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.now = f.now.Add(d)
+	pending := f.timers[:0]
+	for _, t := range f.timers {
+		switch {
+		case t.stopped:
+		case !t.deadline.After(f.now):
+			t.c <- f.now
+		default:
+			pending = append(pending, t)
+		}
+	}
+	f.timers = pending
+}
+
+type fakeTimerOf struct {
+	f *fakeClock
+	t *fakeTimer
+}
+
+func (t fakeTimerOf) C() <-chan time.Time {
+	return t.t.c
+}
+
+func (t fakeTimerOf) Stop() bool {
+	t.f.mux.Lock()
+	defer t.f.mux.Unlock()
+	active := !t.t.stopped && t.t.deadline.After(t.f.now)
+	t.t.stopped = true
+	return active
+}
+
+func TestShutdownTimeoutFakeClock(t *testing.T) {
+	c, codes := newTestCloser(t, Config{ExitCodeErr: 1, ShutdownTimeout: time.Hour})
+	clk := newFakeClock()
+	c.SetClock(clk)
+	running := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	c.BindNamed("stuck", func() {
+		close(running)
+		<-release
+	})
+	go c.Close()
+	waitChan(t, running, "cleanup")
+	waitChan(t, clk.created, "timeout timer")
+	clk.Advance(time.Hour - time.Nanosecond)
+	select {
+	case code := <-codes:
+		t.Fatalf("exited with %d before the timeout", code)
+	case <-time.After(20 * time.Millisecond):
+	}
+	clk.Advance(time.Nanosecond)
+	if code := waitExit(t, codes); code != 1 {
+		t.Errorf("exit code %d, want 1", code)
+	}
+	if skipped := c.SkippedCleanups(); len(skipped) != 1 || skipped[0] != "stuck" {
+		t.Errorf("skipped %v, want [stuck]", skipped)
+	}
+}
+
+func TestJSONLogUsesClock(t *testing.T) {
+	c, codes := newTestCloser(t, Config{})
+	clk := newFakeClock()
+	c.SetClock(clk)
+	c.SetOutputFormat(FormatJSON)
+	var buf bytes.Buffer
+	out := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(out)
+	go c.Close()
+	waitExit(t, codes)
+	waitChan(t, c.exitedChan, "exited")
+	line, _, _ := bytes.Cut(buf.Bytes(), []byte("\n"))
+	var entry struct{ TS string }
+	if err := json.Unmarshal(line, &entry); err != nil {
+		t.Fatalf("log line %q: %v", line, err)
+	}
+	if want := clk.Now().Format(time.RFC3339Nano); entry.TS != want {
+		t.Errorf("ts %q, want %q", entry.TS, want)
+	}
+}
+
+func TestShutdownTimeoutIsShared(t *testing.T) {
+	c, codes := newTestCloser(t, Config{ExitCodeErr: 1, ShutdownTimeout: 10 * time.Second})
+	clk := newFakeClock()
+	c.SetClock(clk)
+	var left []time.Duration
+	takes := func(d time.Duration) func(ctx context.Context) {
+		return func(ctx context.Context) {
+			if len(left) == 0 {
+				// the time must not pass before the timeout timer is set
+				<-clk.created
+			}
+			deadline, _ := ctx.Deadline()
+			left = append(left, deadline.Sub(clk.Now()))
+			clk.Advance(d)
+			if !clk.Now().Before(deadline) {
+				// overrun, the timeout is up
+				<-ctx.Done()
+			}
+		}
+	}
+	// called in the reverse order: 4s, 5s, then 3s out of the 1s left
+	c.BindCtx(takes(3 * time.Second))
+	c.BindCtx(takes(5 * time.Second))
+	c.BindCtx(takes(4 * time.Second))
+	go c.Close()
+	if code := waitExit(t, codes); code != 1 {
+		t.Errorf("exit code %d, want the timeout", code)
+	}
+	want := []time.Duration{10 * time.Second, 6 * time.Second, time.Second}
+	if !reflect.DeepEqual(left, want) {
+		t.Errorf("budget left %v, want %v", left, want)
+	}
+	if skipped := c.SkippedCleanups(); len(skipped) != 1 {
+		t.Errorf("skipped %v, want the last callback", skipped)
+	}
+}
+
+func TestMinShutdownTimeBeforeCleanups(t *testing.T) {
+	c, codes := newTestCloser(t, Config{MinShutdownTime: 30 * time.Second})
+	clk := newFakeClock()
+	c.SetClock(clk)
+	start := clk.Now()
+	cleaned := make(chan time.Time, 1)
+	c.Bind(func() { cleaned <- clk.Now() })
+	c.SendSignal(syscall.SIGTERM)
+	waitChan(t, clk.created, "hold timer")
+	select {
+	case <-c.ShutdownStarted():
+	default:
+		t.Error("the hold started before the readiness checks fail")
+	}
+	clk.Advance(30*time.Second - time.Nanosecond)
+	select {
+	case <-cleaned:
+		t.Fatal("the cleanups started before the MinShutdownTime")
+	case <-time.After(20 * time.Millisecond):
+	}
+	clk.Advance(time.Nanosecond)
+	if at := <-cleaned; at.Sub(start) < 30*time.Second {
+		t.Errorf("the cleanups started after %v, want 30s", at.Sub(start))
+	}
+	waitExit(t, codes)
+}
+
+func TestMinShutdownTimeCutShort(t *testing.T) {
+	c, codes := newTestCloser(t, Config{MinShutdownTime: 30 * time.Second})
+	clk := newFakeClock()
+	c.SetClock(clk)
+	cleaned := make(chan struct{})
+	c.Bind(func() { close(cleaned) })
+	c.SendSignal(syscall.SIGTERM)
+	waitChan(t, clk.created, "hold timer")
+	c.SendSignal(syscall.SIGTERM)
+	waitChan(t, cleaned, "cleanup")
+	waitExit(t, codes)
+}
+
+func TestTimeoutNamesTheStuckCleanup(t *testing.T) {
+	c, codes := newTestCloser(t, Config{ShutdownTimeout: time.Second})
+	clk := newFakeClock()
+	c.SetClock(clk)
+	var timeoutErr error
+	c.BindWithErrors(func(errs []error) { timeoutErr = errors.Join(errs...) })
+	running := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	c.BindNamed("flush-remote", func() {
+		close(running)
+		<-release
+	}).SetLabel("db")
+	go c.Close()
+	waitChan(t, running, "cleanup")
+	waitChan(t, clk.created, "timeout timer")
+	clk.Advance(time.Second)
+	waitExit(t, codes)
+	if timeoutErr == nil || !strings.Contains(timeoutErr.Error(), `stuck in cleanup "flush-remote"`) {
+		t.Errorf("timeout error %v, want it to name the stuck cleanup", timeoutErr)
+	}
+	if skipped := c.SkippedCleanups(); !reflect.DeepEqual(skipped, []string{"flush-remote"}) {
+		t.Errorf("skipped %v, want [flush-remote]", skipped)
+	}
+}
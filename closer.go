@@ -16,16 +16,38 @@
 //   error != nil  | 1 (failure)
 //   panic         | 1 (failure)
 //
+// Shutdown order
+//
+// The shutdown goes through the following steps, strictly in this order, whatever has caused it:
+//
+//   1. the hooks bound via OnShutdownStart
+//   2. ShutdownStarted gets closed and Context done, so the readiness checks fail and the work drains,
+//      then the MinShutdownTime hold
+//   3. the cleanup callbacks, ordered as described by Bind, BindAfter and BindChild, then BindMainThread,
+//      then BindWithErrors
+//   4. the callbacks bound via BindOnError or BindOnSuccess
+//   5. the callbacks bound via BindAlways, then the function set via SetExitCodeHook
+//   6. the pid file removal, the exit reason file and the clean shutdown flag,
+//      see WritePIDFile, SetExitReasonFile and MarkCleanShutdown, then the function set via SetFinalFlush
+//   7. the hook set via OnShutdownComplete
+//   8. the output gets flushed (see SetStackWriter), then os.Exit
+//
 package closer
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
 	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 )
 
 var (
@@ -38,6 +60,11 @@ var (
 	}
 	// DefaultSignalSet will have syscall.SIGABRT that should be
 	// opted out if user wants to debug the stacktrace.
+	//
+	// Catching SIGABRT makes sense when it's sent by the tooling as a stop request (e.g. some supervisors
+	// or watchdogs do), so the cleanups still run. But SIGABRT is also how the aborts (e.g. from CGo code)
+	// and the crash dumps (GOTRACEBACK=crash) get through, which the closer would then turn into a regular
+	// shutdown, masking the real abort. Use DebugSignalSet (via Init or SetSignals) to leave SIGABRT alone.
 	DefaultSignalSet = append(DebugSignalSet, syscall.SIGABRT)
 )
 
@@ -46,224 +73,2365 @@ var (
 	ExitCodeOK = 0
 	// ExitCodeErr is a failure exit code.
 	ExitCodeErr = 1
-	// ExitSignals is the active list of signals to watch for.
+	// ExitSignals is the list of signals the default closer watches for. It's read as the default closer
+	// is created, that is on the first use of the package functions, so assign it before or use SetSignals.
+	// As that first use may well be a Bind from the init of any imported package, the default closer
+	// not configured by Init or SetSignals reads ExitSignals, ExitCodeOK and ExitCodeErr again as
+	// the package-level Hold, HoldResult or Run is called.
+	//
+	// Don't add SIGPIPE there: it's received on every write to a broken connection, which must not shut
+	// a server down. A network server should rather ignore it altogether, see IgnoreSIGPIPE.
 	ExitSignals = DefaultSignalSet
 )
 
-// Config should be used with Init function to override the defaults.
+var (
+	// ErrAlreadyShutDown is returned by Shutdown if a close request has already been made before.
+	ErrAlreadyShutDown = errors.New("closer: already shut down")
+	// ErrShuttingDown is returned by BindE, RunSignalCleanups and WaitReady if the shutdown has already started.
+	ErrShuttingDown = errors.New("closer: shutting down")
+	// ErrShutdownTimeout is wrapped by the error of the shutdown that took longer than ShutdownTimeout.
+	ErrShutdownTimeout = errors.New("closer: shutdown timed out")
+	// ErrCleanupFailed is wrapped by the aggregated error of the cleanup callbacks that failed or panicked,
+	// e.g. returned by Shutdown.
+	ErrCleanupFailed = errors.New("closer: cleanup failed")
+)
+
+// Config should be used with Init function to override the defaults, or with NewCloser.
 type Config struct {
-	ExitCodeOK  int
+	ExitCodeOK int
+	// ExitCodeErr is the exit code of a failed shutdown. If both codes are left zero, it's 1, so an error
+	// doesn't pass for a success.
 	ExitCodeErr int
 	ExitSignals []os.Signal
+	// ShutdownTimeout bounds the time the cleanup callbacks may take, once it elapses
+	// the app exits with ExitCodeErr. Zero means no timeout.
+	//
+	// It's the budget shared by all the callbacks rather than the timeout of each: the slow ones leave less
+	// for those that follow, but none of them overruns the total. The context passed to the callbacks
+	// (see BindCtx) has the deadline of the budget, so each can tell how much is left of it.
+	ShutdownTimeout time.Duration
+	// DumpGoroutinesOnTimeout makes closer write the stacks of all goroutines
+	// to the stack writer when the ShutdownTimeout elapses.
+	DumpGoroutinesOnTimeout bool
+	// GoroutineDumpSize is the max size of the goroutine dump in bytes, 1 MiB by default.
+	GoroutineDumpSize int
+	// RepanicAfterCleanup makes a recovered panic propagate again once the cleanups have run, instead of
+	// the exit, so a debugger breaks on it and the runtime prints its trace. It's meant for development.
+	RepanicAfterCleanup bool
+	// MinShutdownTime is how long the shutdown caused by a signal waits, once the readiness checks fail, before
+	// it calls the cleanups, e.g. to let a load balancer deregister the app while the servers still serve the
+	// requests in flight. Another signal cuts it short. The ShutdownTimeout only counts from the cleanups on.
+	MinShutdownTime time.Duration
+	// FoldSignalCleanups makes the callbacks bound via BindSignal run on the shutdown caused by any signal,
+	// not just their own. Useful if some signal may never arrive, e.g. SIGQUIT (Ctrl+\) without a terminal.
+	FoldSignalCleanups bool
+	// MaxPrintedFrames caps how many frames of a panic stacktrace are written to the stack writer,
+	// the rest is summed up by a line. The log function still gets all the frames. Zero means no cap.
+	MaxPrintedFrames int
+	// ExitStrategy defines how the app exits after the shutdown, ExitOS by default.
+	ExitStrategy ExitStrategy
+	// ReloadSignals is the list of signals that trigger a Reload instead of the shutdown, e.g. SIGHUP.
+	// A signal listed both here and in ExitSignals triggers the reload.
+	ReloadSignals []os.Signal
+	// SignalDuringCleanup defines what a signal received while the cleanups run does,
+	// IgnoreDuringCleanup by default.
+	SignalDuringCleanup SignalPolicy
+	// PanicLogPrefix is what the message of a recovered panic (and the error it's turned into) starts with,
+	// DefaultPanicLogPrefix if empty.
+	PanicLogPrefix string
+	// ProgressInterval makes the progress of the cleanups (how many are done and which one is running)
+	// be logged every interval while they run. Zero means no progress reports.
+	ProgressInterval time.Duration
+	// CleanupOrder defines the order the cleanup callbacks are called in, LIFO by default.
+	CleanupOrder CleanupOrder
+	// ErrorDebounce is the window since a failure (a recovered panic, an error of Checked or a Fatal call) the next failures
+	// are not logged within, but counted (see DebouncedErrors), e.g. as many goroutines hit the same fatal
+	// condition at once. Only the first error is kept anyway. Zero means every failure is logged.
+	ErrorDebounce time.Duration
+	// StrictCleanupCheck makes the app exit with ExitCodeErr if none of the cleanups due has been called,
+	// which is a bug of the closer, always logged as an error anyway.
+	StrictCleanupCheck bool
+	// KeepExitCodeOnCleanupPanic makes a panic in a cleanup callback leave the exit code as is, while by default
+	// the shutdown that would exit with ExitCodeOK exits with ExitCodeErr then. Either way the panic is logged
+	// as a cleanup error and the OnPanic hooks are called with it. It stands for a CleanupPanicAffectsExitCode
+	// option defaulting to true, inverted as the zero Config must keep that default.
+	KeepExitCodeOnCleanupPanic bool
+	// FailCloseOnCleanupError makes the shutdown requested by Close (or Shutdown) exit with ExitCodeErr if any
+	// cleanup callback has returned an error, so the orchestrators notice. It only promotes ExitCodeOK: a code
+	// requested via Exit (that doesn't go through Close anyway) or set by SetPanicClassifier is kept as is.
+	FailCloseOnCleanupError bool
+	// SignalExitCodeMode makes the shutdown caused by a signal exit with 128 plus the signal number like a shell
+	// reports it, e.g. 130 for SIGINT and 143 for SIGTERM, instead of ExitCodeOK, so the supervisors can tell
+	// the signal. The code set via On(sig).ExitCode takes precedence, and as for it, the BindOnSuccess callbacks
+	// are not called. The numbers are those of syscall.Signal, so they differ across the platforms (e.g. SIGUSR1
+	// is 10 on Linux but 30 on macOS), and on Windows only SIGINT and SIGTERM may ever arrive.
+	SignalExitCodeMode bool
+	// StackFormat defines how the frames of the panic stacktraces are printed, StackFull by default.
+	StackFormat StackFormat
+}
+
+// ExitStrategy defines how the app exits after the shutdown.
+type ExitStrategy int
+
+const (
+	// ExitOS terminates the process via os.Exit.
+	ExitOS ExitStrategy = iota
+	// ExitGoexit calls runtime.Goexit on the closer's goroutine instead, leaving the process alive,
+	// for a plugin that must not kill its host. Note that the main (or any other) goroutine keeps running
+	// then: the close requests return, so the host has to observe Done and Err to know the outcome.
+	ExitGoexit
+)
+
+// CleanupOrder defines the order the cleanup callbacks are called in, relative to the order
+// they were bound. The BindAfter dependencies take precedence.
+type CleanupOrder int
+
+const (
+	// LIFO calls the callbacks in the reverse order they were bound, like defer does.
+	LIFO CleanupOrder = iota
+	// FIFO calls the callbacks in the order they were bound.
+	FIFO
+)
+
+// SignalPolicy defines what a signal received while the cleanups run does.
+type SignalPolicy int
+
+const (
+	// IgnoreDuringCleanup leaves the cleanups running as if no signal was received.
+	IgnoreDuringCleanup SignalPolicy = iota
+	// ForceExit exits right away with ExitCodeErr, skipping the remaining cleanups and the hooks but those bound
+	// via BindAlways, while the exit reason, SetFinalFlush and OnShutdownComplete still go first. It only applies
+	// when the shutdown ends up in os.Exit (see ExitStrategy and Shutdown), AccelerateTimeouts otherwise.
+	ForceExit
+	// AccelerateTimeouts cancels the context of the cleanups, so the in-flight one stops waiting and
+	// the remaining ones still run but don't wait for anything either.
+	AccelerateTimeouts
+)
+
+// DefaultGoroutineDumpSize is the default max size of the goroutine dump.
+const DefaultGoroutineDumpSize = 1 << 20
+
+// DefaultPanicLogPrefix is the default Config.PanicLogPrefix.
+const DefaultPanicLogPrefix = "run time panic: "
+
+// signalBuffer is the capacity of the signal channel, os/signal drops the signals that don't fit. It must hold
+// a burst received before the waiting goroutine starts (or while it's busy), e.g. a few reload signals
+// followed by the exit one: none of them can be lost, as each one counts.
+const signalBuffer = 16
+
+// ShutdownCause tells what has triggered the shutdown.
+type ShutdownCause int
+
+const (
+	// CauseNone means there's no shutdown yet.
+	CauseNone ShutdownCause = iota
+	// CauseSignal means one of the watched OS signals has been received.
+	CauseSignal
+	// CauseClose means a programmatic close request (Close, Exit with ExitCodeOK or Shutdown).
+	CauseClose
+	// CauseError means an error: Fatalln, Fatalf, Exit with an error code or Checked's target returned an error.
+	CauseError
+	// CausePanic means a recovered panic.
+	CausePanic
+)
+
+func (cause ShutdownCause) String() string {
+	switch cause {
+	case CauseSignal:
+		return "signal"
+	case CauseClose:
+		return "close"
+	case CauseError:
+		return "error"
+	case CausePanic:
+		return "panic"
+	default:
+		return "none"
+	}
+}
+
+// stdCloser is the default closer, used by the package-level functions. It's created on the first use
+// (see std), so importing the package neither watches for the signals nor starts a goroutine.
+var (
+	stdOnce   sync.Once
+	stdCloser *Closer
+)
+
+// std returns the default closer, creating it if needed.
+func std() *Closer {
+	stdOnce.Do(func() {
+		stdCloser = newCloser(Config{
+			ExitCodeOK:  ExitCodeOK,
+			ExitCodeErr: ExitCodeErr,
+			ExitSignals: ExitSignals,
+		}, true, false)
+		stdCloser.fromVars = true
+	})
+	return stdCloser
+}
+
+// syncVars applies the package-level variables changed since the default closer has been created from them,
+// unless it has been configured explicitly since.
+func (c *Closer) syncVars() {
+	c.sem.Lock()
+	defer c.sem.Unlock()
+	if !c.fromVars || c.IsClosing() {
+		return
+	}
+	if c.codeOK == ExitCodeOK && c.codeErr == ExitCodeErr && sameSignals(c.signals, ExitSignals) {
+		return
+	}
+	// restart the waiting the same way Init does
+	signal.Stop(c.signalChan)
+	close(c.cancelWaitChan)
+	c.cancelWaitChan = make(chan struct{})
+	c.mux.Lock()
+	c.codeOK, c.codeErr = ExitCodeOK, ExitCodeErr
+	c.mux.Unlock()
+	c.signals = ExitSignals
+	c.watch()
+	go c.wait(c.cancelWaitChan)
+}
+
+func sameSignals(a, b []os.Signal) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
 }
 
-var c = newCloser()
+// registry holds the closers created by NewCloser, in the order they were created.
+var registry struct {
+	sync.Mutex
+	closers []*Closer
+}
 
-type closer struct {
-	codeOK     int
-	codeErr    int
-	signals    []os.Signal
-	sem        sync.Mutex
-	closeOnce  sync.Once
-	cleanups   []func()
-	errChan    chan struct{}
-	doneChan   chan struct{}
+// Closer is an independent set of cleanup callbacks with its own Config, the package-level functions
+// use the default one. Several closers let each module of an app tune its own shutdown, see NewCloser and Chain.
+type Closer struct {
+	// root is set for the default closer, its shutdown drives the registered closers
+	root bool
+	// codeOK and codeErr are written holding both c.sem and c.mux, see exitCodes
+	codeOK  int
+	codeErr int
+	signals []os.Signal
+	// watched is what signal.Notify has been called with
+	watched []os.Signal
+	// sourceStop stops forwarding the signals from the source set via SetSignalSource
+	sourceStop    chan struct{}
+	reloadSignals []os.Signal
+	timeout       time.Duration
+	dump          bool
+	dumpSize      int
+	repanic       bool
+	minTime       time.Duration
+	fold          bool
+	maxFrames     int
+	strategy      ExitStrategy
+	sigPolicy     SignalPolicy
+	panicPrefix   string
+	progress      time.Duration
+	order         CleanupOrder
+	debounce      time.Duration
+	strict        bool
+	keepCode      bool
+	failOnErr     bool
+	shellCodes    bool
+	stackFormat   StackFormat
+	sem           sync.Mutex
+	closeOnce     sync.Once
+	cleanups      []cleanup
+	// seq is the sequence number of the last bound cleanup
+	seq        uint64
+	onError    []func(cause ShutdownCause, err error)
+	onSuccess  []func()
+	onAlways   []func()
+	withErrors []func(errs []error)
+	onStart    []func(cause ShutdownCause)
+	alwaysOnce sync.Once
+	onOther    func(sig os.Signal)
+	classify   func(recovered interface{}) int
+	codeHook   func(code int, cause ShutdownCause, err error) int
+	finalFlush func()
+	onMain     []func()
+	holding    atomic.Int32
+	started    atomic.Bool
+	holdResult atomic.Bool
+	// forced is set by the forced exit, see ForceExit
+	forced atomic.Bool
+	// observeOnly is set by SetObserveOnly
+	observeOnly atomic.Bool
+	// cleanupPanicked is set once a cleanup callback has panicked
+	cleanupPanicked atomic.Bool
+	// reloadMux serializes the reloads
+	reloadMux sync.Mutex
+	onReload  []func()
+	ran       atomic.Int32
+	// total is the number of the cleanups to run, current is the name of the running one
+	total   atomic.Int32
+	current atomic.Pointer[string]
+	// position is the index of the running cleanup in running, skipped are the cleanups left by the timeout
+	position   atomic.Int32
+	skipped    []string
+	onComplete func(total time.Duration, code int, ran int, firstErr error)
+	onHalfway  func(remaining int)
+	// mux guards the state below
+	mux        sync.Mutex
+	err        error
+	panicked   bool
+	panicValue interface{}
+	cause      ShutdownCause
+	sig        os.Signal
+	sigCounts  map[os.Signal]int
+	// watchedNames are the names of the watched signals, for Snapshot
+	watchedNames []string
+	// critical is the depth of the critical sections, pendingSig is the signal received in there
+	critical   int
+	pendingSig os.Signal
+	// running is the list of the cleanups the shutdown runs, see Snapshot
+	running []cleanup
+	// ignoredCounts counts the signals ignored during the cleanups
+	ignoredCounts map[os.Signal]int
+	// code is the exit code requested by Exit, sigCodes are those set by SignalRule.ExitCode
+	code       *int
+	sigCodes   map[os.Signal]int
+	cleanupErr error
+	// exitCode is the exit code of the completed shutdown
+	exitCode int
+	// escalated is set by an error exit requested by a callback during the shutdown
+	escalated bool
+	// callbacks counts the running shutdowns and reloads whose callbacks must not be waited for,
+	// see enterCallbacks
+	callbacks atomic.Int32
+	// loggedFailure is when the last logged failure happened, see ErrorDebounce
+	loggedFailure  time.Time
+	debouncedCount int
+	// causeErr is the error that caused the shutdown
+	causeErr   error
+	logFunc    func(level, msg string, kv ...interface{})
+	logCtxFunc func(ctx context.Context, level, msg string, kv ...interface{})
+	format     OutputFormat
+	stackOut   io.Writer
+	onPanic    []func(recovered interface{}, stack []StackFrame)
+	panicFmt   func(recovered interface{}) string
+	pidFile    string
+	reasonFile string
+	cleanFile  string
+	// ctx is done as the shutdown starts, its values are those of base, see SetBaseContext
+	ctx       context.Context
+	cancelCtx context.CancelFunc
+	base      atomic.Pointer[context.Context]
+	// exit is os.Exit and clock is realClock unless overridden, see SetExitFunc and SetClock
+	exit     func(code int)
+	clock    Clock
+	errChan  chan struct{}
+	doneChan chan struct{}
+	// exitedChan gets closed once the exit is done, unless it has terminated the app
+	exitedChan chan struct{}
 	signalChan chan os.Signal
 	closeChan  chan struct{}
 	holdChan   chan struct{}
+	holdOnce   sync.Once
+	// startedChan gets closed as the shutdown starts
+	startedChan chan struct{}
+	// mainChan passes the main thread cleanups to Hold, mainDone reports they're done
+	mainChan chan []func()
+	mainDone chan struct{}
+	// shutdownChan requests the cleanup without exit
+	shutdownChan chan struct{}
 	//
 	cancelWaitChan chan struct{}
+	// readyChan gets closed by Ready, created is when the closer was created
+	readyChan chan struct{}
+	readyOnce sync.Once
+	created   time.Time
+	// fromVars is set while the default closer is configured by the package-level variables, see syncVars
+	fromVars bool
+	// cleanupOnly is set by NewCleanupOnly, the shutdown goroutine is started by waitOnce then
+	cleanupOnly bool
+	waitOnce    sync.Once
+}
+
+// NewCloser creates a closer configured by cfg and registers it, so the shutdown of the default closer
+// (or ShutdownAll) drives it. It watches for the OS signals only if cfg.ExitSignals is not empty,
+// but the closers of the app modules should leave it empty, the default closer alone owning
+// the signal handling. Note that Close, Exit and the other close requests of any closer still
+// terminate the app.
+func NewCloser(cfg Config) *Closer {
+	cl := newCloser(cfg, false, false)
+	registry.Lock()
+	registry.closers = append(registry.closers, cl)
+	registry.Unlock()
+	return cl
+}
+
+// NewCleanupOnly creates a closer that is a mere teardown coordinator, e.g. for a serverless function whose
+// lifecycle is managed by the runtime: it never watches for the signals (cfg.ExitSignals and cfg.ReloadSignals
+// are ignored) and starts no goroutine until the shutdown. It's registered just like by NewCloser. The API that
+// makes sense then is that of binding the callbacks, Shutdown and RunSignalCleanups; the close requests still
+// work and start the shutdown on demand, but Init, SetSignals, SetSignalSource and Hold are not meant for it.
+func NewCleanupOnly(cfg Config) *Closer {
+	cfg.ExitSignals, cfg.ReloadSignals = nil, nil
+	cl := newCloser(cfg, false, true)
+	registry.Lock()
+	registry.closers = append(registry.closers, cl)
+	registry.Unlock()
+	return cl
 }
 
-func newCloser() *closer {
-	c := &closer{
-		codeOK:  ExitCodeOK,
-		codeErr: ExitCodeErr,
-		signals: ExitSignals,
+func newCloser(cfg Config, root, cleanupOnly bool) *Closer {
+	c := &Closer{
+		root:        root,
+		cleanupOnly: cleanupOnly,
+		exit:        os.Exit,
+		clock:       realClock{},
+		//
+		stackOut: os.Stdout,
 		//
 		errChan:    make(chan struct{}),
 		doneChan:   make(chan struct{}),
-		signalChan: make(chan os.Signal, 1),
+		exitedChan: make(chan struct{}),
+		signalChan: make(chan os.Signal, signalBuffer),
 		closeChan:  make(chan struct{}),
 		holdChan:   make(chan struct{}),
 		//
+		startedChan: make(chan struct{}),
+		mainChan:    make(chan []func()),
+		mainDone:    make(chan struct{}),
+		//
+		shutdownChan:   make(chan struct{}),
 		cancelWaitChan: make(chan struct{}),
+		readyChan:      make(chan struct{}),
 	}
-
-	signal.Notify(c.signalChan, c.signals...)
+	c.created = c.clock.Now()
+	c.ctx, c.cancelCtx = context.WithCancel(c.valuesContext())
+	c.configure(cfg)
 
 	// start waiting
-	go c.wait()
+	if !cleanupOnly {
+		go c.wait(c.cancelWaitChan)
+	}
 	return c
 }
 
-func (c *closer) wait() {
-	exitCode := c.codeOK
+// exitCodes returns the ExitCodeOK and ExitCodeErr of the closer, Init may change them at any time.
+// The code holding c.sem may read them directly.
+func (c *Closer) exitCodes() (ok, failed int) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.codeOK, c.codeErr
+}
 
-	// wait for a close request
-	select {
-	case <-c.cancelWaitChan:
+// configure applies cfg and starts watching for its signals. The caller must hold c.sem.
+func (c *Closer) configure(cfg Config) {
+	c.mux.Lock()
+	c.codeOK = cfg.ExitCodeOK
+	c.codeErr = cfg.ExitCodeErr
+	if c.codeOK == 0 && c.codeErr == 0 {
+		c.codeErr = 1
+	}
+	c.mux.Unlock()
+	c.signals = cfg.ExitSignals
+	c.reloadSignals = cfg.ReloadSignals
+	c.timeout = cfg.ShutdownTimeout
+	c.dump = cfg.DumpGoroutinesOnTimeout
+	c.dumpSize = cfg.GoroutineDumpSize
+	c.repanic = cfg.RepanicAfterCleanup
+	c.minTime = cfg.MinShutdownTime
+	c.fold = cfg.FoldSignalCleanups
+	c.maxFrames = cfg.MaxPrintedFrames
+	c.strategy = cfg.ExitStrategy
+	c.sigPolicy = cfg.SignalDuringCleanup
+	c.panicPrefix = cfg.PanicLogPrefix
+	c.progress = cfg.ProgressInterval
+	c.order = cfg.CleanupOrder
+	c.debounce = cfg.ErrorDebounce
+	c.strict = cfg.StrictCleanupCheck
+	c.keepCode = cfg.KeepExitCodeOnCleanupPanic
+	c.failOnErr = cfg.FailCloseOnCleanupError
+	c.shellCodes = cfg.SignalExitCodeMode
+	c.stackFormat = cfg.StackFormat
+	if len(c.panicPrefix) == 0 {
+		c.panicPrefix = DefaultPanicLogPrefix
+	}
+	if c.dumpSize <= 0 {
+		c.dumpSize = DefaultGoroutineDumpSize
+	}
+	c.watch()
+}
+
+// watch starts watching for the signals. The caller must hold c.sem.
+func (c *Closer) watch() {
+	if c.cleanupOnly {
+		return
+	}
+	for _, cb := range c.cleanups {
+		if cb.signal != nil {
+			c.checkWatched(cb.signal)
+		}
+	}
+	if c.sourceStop != nil {
+		// the signals come from the source set via SetSignalSource
+		c.watched = nil
+		c.mux.Lock()
+		c.watchedNames = nil
+		c.mux.Unlock()
 		return
-	case <-c.signalChan:
-	case <-c.closeChan:
+	}
+	c.watched = append(c.signals[:len(c.signals):len(c.signals)], c.reloadSignals...)
+	if len(c.watched) > 0 {
+		// signal.NotifyContext is not used here on purpose: the context it yields
+		// doesn't tell which signal has been received.
+		signal.Notify(c.signalChan, c.watched...)
+	}
+	names := make([]string, 0, len(c.watched))
+	for _, sig := range c.watched {
+		names = append(names, SignalName(sig))
+		if sig == sigPIPE {
+			c.log(LevelWarn, "sigpipe_watched", "SIGPIPE is watched for, a broken pipe will shut the app down")
+		}
+	}
+	c.mux.Lock()
+	c.watchedNames = names
+	c.mux.Unlock()
+	c.log(LevelInfo, "watching", "watching for signals: "+strings.Join(names, ", "), "signals", names)
+}
+
+// WatchedSignals returns the signals the closer is watching for, that's the ExitSignals
+// and the ReloadSignals. The returned slice is a copy.
+func WatchedSignals() []os.Signal {
+	return std().WatchedSignals()
+}
+
+// WatchedSignals is the same as the package-level WatchedSignals but for this closer.
+func (c *Closer) WatchedSignals() []os.Signal {
+	c.sem.Lock()
+	defer c.sem.Unlock()
+	return append([]os.Signal(nil), c.watched...)
+}
+
+// SetSignals replaces the list of the signals to watch for (Config.ExitSignals) and starts watching for them
+// right away, leaving the rest of the config as is. No signals means no signals are watched for. Note that
+// assigning ExitSignals has no effect once the default closer is in use.
+func SetSignals(sigs ...os.Signal) {
+	std().SetSignals(sigs...)
+}
+
+// SetSignals is the same as the package-level SetSignals but for this closer.
+func (c *Closer) SetSignals(sigs ...os.Signal) {
+	c.sem.Lock()
+	defer c.sem.Unlock()
+	c.fromVars = false
+	signal.Stop(c.signalChan)
+	c.signals = sigs
+	c.watch()
+}
+
+// wait waits for a close request and performs the cleanup, it returns early
+// if cancel gets closed (Init does that to restart the waiting).
+func (c *Closer) wait(cancel <-chan struct{}) {
+	var exitCode int
+	exit := true
+	var cause ShutdownCause
+	var sig os.Signal
+
+	// wait for a close request, the reload signals don't end the waiting
+	for {
+		select {
+		case <-cancel:
+			return
+		case received := <-c.signalChan:
+			// sig is only set by the signal that ends the waiting
+			if c.observeOnly.Load() {
+				c.log(LevelWarn, "signal_observed", "signal "+SignalName(received)+" received, observing only",
+					"signal", SignalName(received), "ts", c.clock.Now())
+				c.addIgnored(received)
+				continue
+			}
+			if c.isReloadSignal(received) {
+				c.countSignal(received)
+				c.Reload()
+				continue
+			}
+			if c.deferSignal(received) {
+				continue
+			}
+			sig = received
+			cause = CauseSignal
+		case <-c.closeChan:
+			cause = CauseClose
+		case <-c.errChan:
+			cause = CauseError
+			c.mux.Lock()
+			exitCode = c.codeErr
+			if c.code != nil {
+				exitCode = *c.code
+			}
+			c.mux.Unlock()
+		case <-c.shutdownChan:
+			exit = false
+			cause = CauseClose
+		}
 		break
-	case <-c.errChan:
-		exitCode = c.codeErr
 	}
+	if cause != CauseError {
+		// the codes are read once the request has arrived, Init may change them meanwhile
+		exitCode, _ = c.exitCodes()
+	}
+	if c.holdResult.Load() {
+		// the caller of HoldResult exits
+		exit = false
+	}
+	if !c.started.CompareAndSwap(false, true) {
+		// another waiting goroutine (replaced by Init) got here first
+		return
+	}
+	// the hooks run by the shutdown must not wait for it
+	defer c.enterCallbacks()()
+	c.mux.Lock()
+	if cause == CauseError && c.panicked {
+		cause = CausePanic
+	}
+	c.cause = cause
+	c.sig = sig
+	if code, ok := c.sigCodes[sig]; ok && cause == CauseSignal {
+		exitCode = code
+	} else if n, ok := signalNumber(sig); ok && cause == CauseSignal && c.shellCodes {
+		exitCode = 128 + n
+	}
+	if cause == CauseError || cause == CausePanic {
+		c.causeErr = c.err
+	}
+	c.mux.Unlock()
+	if sig != nil {
+		c.countSignal(sig)
+		c.log(LevelInfo, "shutdown", "shutdown started", "cause", cause, "signal", SignalName(sig))
+	} else {
+		c.log(LevelInfo, "shutdown", "shutdown started", "cause", cause)
+	}
+	c.sem.Lock()
+	onStart := c.onStart
+	c.sem.Unlock()
+	for _, fn := range onStart {
+		fn := fn
+		c.callHook("OnShutdownStart", func() { fn(cause) })
+	}
+	// stop the readiness and the ongoing work
+	close(c.startedChan)
+	c.cancelCtx()
+	// let a reload in progress complete
+	c.reloadMux.Lock()
+	c.reloadMux.Unlock()
 
+	start := c.clock.Now()
+	var ran int
+	var timedOut bool
 	// ensure we'll exit
-	defer os.Exit(exitCode)
+	defer func() {
+		// runtime.Goexit still runs this
+		defer close(c.exitedChan)
+		if c.forced.Load() {
+			_, exitCode = c.exitCodes()
+		}
+		kv := []interface{}{"cause", cause, "code", exitCode, "duration", c.clock.Now().Sub(start), "ran", ran}
+		if err := c.firstErr(); err != nil {
+			kv = append(kv, "error", err)
+		}
+		c.log(LevelInfo, "complete", "shutdown completed", kv...)
+		c.removePIDFile()
+		c.writeExitReason(cause, sig, exitCode, c.firstErr())
+		c.writeCleanFlag(cause, exitCode)
+		c.sem.Lock()
+		finalFlush, onComplete, exitFunc := c.finalFlush, c.onComplete, c.exit
+		c.sem.Unlock()
+		if finalFlush != nil {
+			c.callHook("SetFinalFlush", finalFlush)
+		}
+		if onComplete != nil {
+			completeErr := c.firstErr()
+			if timedOut && !errors.Is(completeErr, ErrShutdownTimeout) {
+				// the error that caused the shutdown comes first, the timeout still tells what's unfinished
+				completeErr = errors.Join(completeErr, c.cleanupErr)
+			}
+			onComplete(c.clock.Now().Sub(start), exitCode, ran, completeErr)
+		}
+		c.flushOutput()
+		if cause == CausePanic && c.repanic {
+			// the goroutine that recovered the panic will panic again
+			exit = false
+		}
+		if !exit {
+			c.releaseHold()
+			return
+		}
+		if c.strategy == ExitGoexit {
+			// Hold returns, the process stays alive
+			c.releaseHold()
+			runtime.Goexit()
+		}
+		exitFunc(exitCode)
+		// the exit has been overridden
+		c.releaseHold()
+	}()
+
+	if cause == CauseSignal {
+		c.holdOn(start)
+	}
 
 	c.sem.Lock()
 	defer c.sem.Unlock()
-	for _, fn := range c.cleanups {
-		fn()
+	if sig != nil && c.onOther != nil && !c.hasSignalCleanups(sig) {
+		onOther := c.onOther
+		c.callHook("OnOtherSignal", func() { onOther(sig) })
+	}
+	stopProgress := c.reportProgress()
+	ran, c.cleanupErr, timedOut = c.runCleanupsTimeout(exit)
+	stopProgress()
+	if c.forced.Load() {
+		c.mux.Lock()
+		c.exitCode = c.codeErr
+		c.mux.Unlock()
+		close(c.doneChan)
+		return
+	}
+	c.mux.Lock()
+	if c.escalated && exitCode == c.codeOK {
+		// a callback has requested an error exit
+		exitCode = c.codeErr
+		if c.code != nil {
+			exitCode = *c.code
+		}
+	}
+	c.mux.Unlock()
+	if timedOut || (c.cleanupPanicked.Load() && !c.keepCode && exitCode == c.codeOK) {
+		exitCode = c.codeErr
+	} else if c.failOnErr && cause == CauseClose && c.cleanupErr != nil && exitCode == c.codeOK {
+		exitCode = c.codeErr
+	} else if due := c.total.Load(); due > 0 && ran == 0 {
+		// must never happen, the bound callbacks have been lost
+		c.log(LevelError, "cleanups_lost", fmt.Sprintf("none of the %d cleanups has been called", due), "due", due)
+		if c.strict {
+			exitCode = c.codeErr
+		}
+	}
+	c.runMainThread()
+	c.runWithErrors(c.cleanupErr)
+	if cause == CausePanic && c.classify != nil {
+		x, classify := c.panicValue, c.classify
+		c.callHook("SetPanicClassifier", func() { exitCode = classify(x) })
+	}
+	if cause == CauseError || cause == CausePanic {
+		err := c.firstErr()
+		for _, fn := range c.onError {
+			fn := fn
+			c.callHook("BindOnError", func() { fn(cause, err) })
+		}
+	} else if exitCode == c.codeOK {
+		for _, fn := range c.onSuccess {
+			c.callHook("BindOnSuccess", fn)
+		}
+	}
+	c.runAlways()
+	if c.codeHook != nil {
+		codeHook, err := c.codeHook, c.firstErr()
+		c.callHook("SetExitCodeHook", func() { exitCode = codeHook(exitCode, cause, err) })
 	}
+	c.mux.Lock()
+	c.exitCode = exitCode
+	c.mux.Unlock()
 	// done!
 	close(c.doneChan)
 }
 
+// holdOn waits until the MinShutdownTime since start elapses or another signal is received, that one cuts it short.
+func (c *Closer) holdOn(start time.Time) {
+	left := c.minTime - c.clock.Now().Sub(start)
+	if left <= 0 {
+		return
+	}
+	timer := c.clock.NewTimer(left)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+	case sig := <-c.signalChan:
+		c.countSignal(sig)
+	}
+}
+
+// SetObserveOnly turns the observe-only mode on or off, a debugging aid to find out what sends the signals
+// to the process: every watched signal received is logged (and counted, see IgnoredSignalCounts) but not acted upon.
+// Note that the app doesn't shut down (nor reload) on any signal in this mode, only a close request or SIGKILL
+// end it. The sender of a signal is not known to os/signal, so it can't be logged.
+func SetObserveOnly(on bool) {
+	std().SetObserveOnly(on)
+}
+
+// SetObserveOnly is the same as the package-level SetObserveOnly but for this closer.
+func (c *Closer) SetObserveOnly(on bool) {
+	c.observeOnly.Store(on)
+}
+
+// BeginCritical starts a critical section, e.g. a replay at startup that must not be interrupted: the watched
+// signals received until EndCritical are not acted upon. The first one of them is queued and delivered
+// as EndCritical is called, so the shutdown starts right after the section then. The close requests are not
+// affected. The sections may nest, EndCritical must be called as many times as BeginCritical is.
+func BeginCritical() {
+	std().BeginCritical()
+}
+
+// BeginCritical is the same as the package-level BeginCritical but for this closer.
+func (c *Closer) BeginCritical() {
+	c.mux.Lock()
+	c.critical++
+	c.mux.Unlock()
+}
+
+// EndCritical ends the critical section started by BeginCritical, see there.
+func EndCritical() {
+	std().EndCritical()
+}
+
+// EndCritical is the same as the package-level EndCritical but for this closer.
+func (c *Closer) EndCritical() {
+	c.mux.Lock()
+	var sig os.Signal
+	if c.critical > 0 {
+		c.critical--
+	}
+	if c.critical == 0 {
+		sig, c.pendingSig = c.pendingSig, nil
+	}
+	c.mux.Unlock()
+	if sig == nil {
+		return
+	}
+	select {
+	case c.signalChan <- sig:
+	case <-c.startedChan:
+		// the shutdown has started meanwhile anyway
+	}
+}
+
+// deferSignal queues the signal received in a critical section, it tells if it did.
+func (c *Closer) deferSignal(sig os.Signal) bool {
+	c.mux.Lock()
+	critical := c.critical > 0
+	if critical && c.pendingSig == nil {
+		c.pendingSig = sig
+	}
+	c.mux.Unlock()
+	if !critical {
+		return false
+	}
+	c.log(LevelWarn, "signal_deferred", "signal "+SignalName(sig)+" received in a critical section, deferred", "signal", SignalName(sig))
+	return true
+}
+
+func (c *Closer) isReloadSignal(sig os.Signal) bool {
+	for _, s := range c.reloadSignals {
+		if s == sig {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Closer) countSignal(sig os.Signal) {
+	c.mux.Lock()
+	if c.sigCounts == nil {
+		c.sigCounts = make(map[os.Signal]int)
+	}
+	c.sigCounts[sig]++
+	c.mux.Unlock()
+}
+
+// SignalCounts returns how many times each signal has been received and acted upon by the closer,
+// a signal that has been ignored is not counted. The returned map is a copy.
+func SignalCounts() map[os.Signal]int {
+	return std().SignalCounts()
+}
+
+// SignalCounts is the same as the package-level SignalCounts but for this closer.
+func (c *Closer) SignalCounts() map[os.Signal]int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return copyCounts(c.sigCounts)
+}
+
+// IgnoredSignalCounts returns how many times each signal has been received and not acted upon, that is while
+// the cleanups ran and ignored as per SignalDuringCleanup (that includes the reload signals) or in the observe-only
+// mode, see SetObserveOnly. The returned map is a copy.
+func IgnoredSignalCounts() map[os.Signal]int {
+	return std().IgnoredSignalCounts()
+}
+
+// IgnoredSignalCounts is the same as the package-level IgnoredSignalCounts but for this closer.
+func (c *Closer) IgnoredSignalCounts() map[os.Signal]int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return copyCounts(c.ignoredCounts)
+}
+
+// countIgnored logs and counts the signal ignored during the cleanups.
+func (c *Closer) countIgnored(sig os.Signal) {
+	c.log(LevelInfo, "signal_ignored", "signal "+SignalName(sig)+" received during cleanup, ignored", "signal", SignalName(sig))
+	c.addIgnored(sig)
+}
+
+// addIgnored counts the signal that hasn't been acted upon, see IgnoredSignalCounts.
+func (c *Closer) addIgnored(sig os.Signal) {
+	c.mux.Lock()
+	if c.ignoredCounts == nil {
+		c.ignoredCounts = make(map[os.Signal]int)
+	}
+	c.ignoredCounts[sig]++
+	c.mux.Unlock()
+}
+
+// SkippedCleanups returns the callbacks that haven't finished as the ShutdownTimeout elapsed: the one
+// that was running and those that were never called, in the shutdown order. A callback is identified
+// by its name, not its label (see Handle.SetLabel), an anonymous one by its position in the order ("#3").
+// It's empty unless the shutdown has timed out.
+func SkippedCleanups() []string {
+	return std().SkippedCleanups()
+}
+
+// SkippedCleanups is the same as the package-level SkippedCleanups but for this closer.
+func (c *Closer) SkippedCleanups() []string {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return append([]string(nil), c.skipped...)
+}
+
+func copyCounts(counts map[os.Signal]int) map[os.Signal]int {
+	cp := make(map[os.Signal]int, len(counts))
+	for sig, n := range counts {
+		cp[sig] = n
+	}
+	return cp
+}
+
 // Close sends a close request.
 // The app will be terminated by OS as soon as the first close request will be handled by closer, this
 // function will return no sooner. The exit code will always be 0 (success).
+//
+// The close requests return only after the exit has been done, not as soon as the cleanups are complete
+// (see Done), so the code that follows them never runs if the app is terminated. They do return if it's not:
+// the exit has been overridden (SetExitFunc, ExitGoexit) or skipped (Shutdown, RepanicAfterCleanup).
+//
+// Only the first close request (made by Close, Exit, Fatalln, Fatalf or Checked) triggers the shutdown,
+// the later ones just wait for it to complete, so Close is safe to call any number of times from any number
+// of goroutines concurrently. If the process survives the shutdown (i.e. the exit has been overridden or
+// it was requested via Shutdown), all the subsequent close requests return immediately.
+//
+// A close request made by a callback while the shutdown runs it returns immediately as well (Shutdown
+// returns ErrShuttingDown), an error exit requested that way (CloseErr, Exit, Fatalln...) makes the shutdown
+// exit with the error exit code unless it already does. This holds for the calls made by the callback
+// itself, not by the goroutines it waits for.
 func Close() {
+	std().close(recover())
+}
+
+// Close is the same as the package-level Close but for this closer.
+func (c *Closer) Close() {
+	c.close(recover())
+}
+
+// close handles either the panic recovered by the caller or a normal close request.
+func (c *Closer) close(x interface{}) {
 	// check if there was a panic
-	if x := recover(); x != nil {
-		var (
-			offset int = 3
-			pc     uintptr
-			ok     bool
-		)
-		log.Printf("run time panic: %v", x)
-		for offset < 32 {
-			pc, _, _, ok = runtime.Caller(offset)
-			if !ok {
-				// close with an error
-				c.closeErr()
-				return
-			}
-			frame := newStackFrame(pc)
-			fmt.Print(frame.String())
-			offset++
-		}
-		// close with an error
-		c.closeErr()
+	if x != nil {
+		c.handlePanic(x, 5, true)
 		return
 	}
 	// normal close
+	if c.reentered(false) {
+		return
+	}
+	c.startWaiting()
 	c.closeOnce.Do(func() {
 		close(c.closeChan)
 	})
-	<-c.doneChan
+	c.awaitExit()
 }
 
-// Fatalln works the same as log.Fatalln but respects the closer's logic.
-func Fatalln(v ...interface{}) {
-	out := log.New(os.Stderr, "", log.Flags())
-	out.Output(2, fmt.Sprintln(v...))
-	c.closeErr()
+// handlePanic calls the OnPanic hooks, logs the recovered panic along with the stacktrace (unless logging
+// is false) and closes with an error. The stacktrace starts at the function that panicked, the offset frames
+// up if it can't be told (see panicStack).
+func (c *Closer) handlePanic(x interface{}, offset int, logging bool) {
+	stack := panicStack(offset)
+	c.runPanicHooks(x, stack)
+	err := c.recordPanic(x)
+	logging = logging && !c.debounced()
+	if logging {
+		c.log(LevelError, "panic", c.panicMessage(x), "panic", x, "stack", stack)
+	}
+	if logging && c.outputFormat() == FormatText {
+		c.writeStack(c.stackWriter(), stack)
+	}
+	// close with an error
+	c.closeErr(err)
+	if c.repanic {
+		panic(x)
+	}
 }
 
-// Fatalf works the same as log.Fatalf but respects the closer's logic.
-func Fatalf(format string, v ...interface{}) {
-	out := log.New(os.Stderr, "", log.Flags())
-	out.Output(2, fmt.Sprintf(format, v...))
-	c.closeErr()
+// Recover handles a panic the same way Close does: it's logged along with the stacktrace and the app
+// is terminated with an error code after all the bound callbacks have been called. Unlike Close, it does
+// nothing if there's no panic, so it may be used at the top of any function, including goroutines.
+// It must be deferred directly (`defer closer.Recover()`) to work, since it calls recover().
+func Recover() {
+	if x := recover(); x != nil {
+		std().handlePanic(x, 4, true)
+	}
 }
 
-// Exit is the same as os.Exit but respects the closer's logic. It converts
-// any error code into ExitCodeErr (= 1, by default).
-func Exit(code int) {
-	// check if there was a panic
+// Recover is the same as the package-level Recover but for this closer.
+func (c *Closer) Recover() {
 	if x := recover(); x != nil {
-		var (
-			offset int = 3
-			pc     uintptr
-			ok     bool
-		)
-		log.Printf("run time panic: %v", x)
-		for offset < 32 {
-			pc, _, _, ok = runtime.Caller(offset)
-			if !ok {
-				// close with an error
-				c.closeErr()
-				return
-			}
-			frame := newStackFrame(pc)
-			fmt.Print(frame.String())
-			offset++
-		}
-		// close with an error
-		c.closeErr()
-		return
-	}
-	if code == ExitCodeOK {
-		c.closeOnce.Do(func() {
-			close(c.closeChan)
-		})
-		<-c.doneChan
-		return
+		c.handlePanic(x, 4, true)
 	}
-	c.closeErr()
 }
 
-func (c *closer) closeErr() {
-	c.closeOnce.Do(func() {
-		close(c.errChan)
-	})
-	<-c.doneChan
+// Fatalln works the same as log.Fatalln but respects the closer's logic: it goes through the same
+// shutdown as a signal or Close do, so all the cleanups get called, including the ones bound to a signal
+// via BindSignal, before the exit with ExitCodeErr.
+func Fatalln(v ...interface{}) {
+	std().fatal(fmt.Sprintln(v...))
 }
 
-// Init allows user to override the defaults (a set of OS signals to watch for, for example).
-func Init(cfg Config) {
-	c.sem.Lock()
-	signal.Stop(c.signalChan)
-	close(c.cancelWaitChan)
-	c.codeOK = cfg.ExitCodeOK
-	c.codeErr = cfg.ExitCodeErr
-	c.signals = cfg.ExitSignals
-	signal.Notify(c.signalChan, c.signals...)
-	go c.wait()
-	c.sem.Unlock()
+// Fatalln is the same as the package-level Fatalln but for this closer.
+func (c *Closer) Fatalln(v ...interface{}) {
+	c.fatal(fmt.Sprintln(v...))
 }
 
-// Bind will register the cleanup function that will be called when closer will get a close request.
-// All the callbacks will be called in the reverse order they were bound, that's similar to how `defer` works.
-func Bind(cleanup func()) {
-	c.sem.Lock()
-	// store in the reverse order
-	s := make([]func(), 0, 1+len(c.cleanups))
-	s = append(s, cleanup)
-	c.cleanups = append(s, c.cleanups...)
-	c.sem.Unlock()
+// Fatalf works the same as log.Fatalf but respects the closer's logic, see Fatalln.
+func Fatalf(format string, v ...interface{}) {
+	std().fatal(fmt.Sprintf(format, v...))
 }
 
-// Checked runs the target function and checks for panics and errors it may yield. In case of panic or error, closer
-// will terminate the app with an error code, but either case it will call all the bound callbacks beforehand.
-// One can use this instead of `defer` if you need to care about errors and panics that always may happen.
-// This function optionally can emit log messages via standard `log` package.
-func Checked(target func() error, logging bool) {
-	defer func() {
-		// check if there was a panic
-		if x := recover(); x != nil {
-			if logging {
-				log.Printf("run time panic: %v", x)
-			}
-			// close with an error
-			c.closeErr()
-		}
-	}()
-	if err := target(); err != nil {
-		if logging {
-			log.Println("error:", err)
-		}
-		// close with an error
-		c.closeErr()
+// Fatalf is the same as the package-level Fatalf but for this closer.
+func (c *Closer) Fatalf(format string, v ...interface{}) {
+	c.fatal(fmt.Sprintf(format, v...))
+}
+
+// fatal logs the message on behalf of the caller of Fatalln or Fatalf and closes with an error.
+func (c *Closer) fatal(msg string) {
+	if !c.debounced() {
+		out := log.New(os.Stderr, "", log.Flags())
+		out.Output(3, msg)
 	}
+	c.closeErr(errors.New(strings.TrimSuffix(msg, "\n")))
+}
+
+// debounced tells if the failure (a panic, an error of Checked or a Fatal call) comes within ErrorDebounce since the last logged one,
+// so it's counted instead of logged.
+func (c *Closer) debounced() bool {
+	if c.debounce <= 0 {
+		return false
+	}
+	now := c.clock.Now()
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if !c.loggedFailure.IsZero() && now.Sub(c.loggedFailure) < c.debounce {
+		c.debouncedCount++
+		return true
+	}
+	c.loggedFailure = now
+	return false
+}
+
+// DebouncedErrors returns how many failures have not been logged as per ErrorDebounce.
+func DebouncedErrors() int {
+	return std().DebouncedErrors()
+}
+
+// DebouncedErrors is the same as the package-level DebouncedErrors but for this closer.
+func (c *Closer) DebouncedErrors() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.debouncedCount
+}
+
+// Exit is the same as os.Exit but respects the closer's logic: it runs the cleanups and then exits
+// with exactly the code provided. A code other than ExitCodeOK counts as an error (see BindOnError).
+//
+// Note that Exit used to convert any error code into ExitCodeErr, that's no longer the case.
+func Exit(code int) {
+	std().exitWith(code, recover())
+}
+
+// Exit is the same as the package-level Exit but for this closer.
+func (c *Closer) Exit(code int) {
+	c.exitWith(code, recover())
+}
+
+// HardExit terminates the app with the code right away via os.Exit, bypassing all the shutdown logic:
+// no cleanups, hooks, logging or pid file removal, and none of the closers is involved. It's the last
+// resort for the states where the cleanups can't be trusted, e.g. a suspected deadlock.
+func HardExit(code int) {
+	os.Exit(code)
+}
+
+func (c *Closer) exitWith(code int, x interface{}) {
+	// check if there was a panic
+	if x != nil {
+		c.handlePanic(x, 5, true)
+		return
+	}
+	if ok, _ := c.exitCodes(); code == ok {
+		c.close(nil)
+		return
+	}
+	c.mux.Lock()
+	if c.code == nil {
+		c.code = &code
+	}
+	c.mux.Unlock()
+	c.closeErr(fmt.Errorf("exit code %d", code))
+}
+
+// recordPanic stores the recovered panic, it returns the error it makes the cause of the shutdown.
+func (c *Closer) recordPanic(x interface{}) error {
+	c.mux.Lock()
+	if !c.panicked {
+		c.panicked = true
+		c.panicValue = x
+	}
+	c.mux.Unlock()
+	return fmt.Errorf("%s%v", c.panicPrefix, x)
+}
+
+// recordErr stores the error that caused the shutdown, only the first one is kept.
+func (c *Closer) recordErr(err error) {
+	c.mux.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.mux.Unlock()
+}
+
+func (c *Closer) receivedSignal() os.Signal {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.sig
+}
+
+// trigger returns the signal that caused the shutdown, if any, and tells if it's been caused by an error or a panic.
+func (c *Closer) trigger() (sig os.Signal, failed bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.sig, c.cause == CauseError || c.cause == CausePanic
+}
+
+func (c *Closer) firstErr() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.err
+}
+
+// CloseErr sends a close request with an error, the same as Fatalln does but without logging:
+// the app will be terminated with ExitCodeErr once all the cleanups have been called. The error is that
+// of the shutdown, it's passed to the callbacks bound via BindOnError and returned by Err; it may be nil.
+func CloseErr(err error) {
+	std().closeErr(err)
+}
+
+// CloseErr is the same as the package-level CloseErr but for this closer.
+func (c *Closer) CloseErr(err error) {
+	c.closeErr(err)
+}
+
+// startWaiting starts the shutdown goroutine of the closer created by NewCleanupOnly.
+func (c *Closer) startWaiting() {
+	if c.cleanupOnly {
+		c.waitOnce.Do(func() {
+			go c.wait(c.cancelWaitChan)
+		})
+	}
+}
+
+// reentered reports whether the close request comes from a callback run by the shutdown, it must not block
+// then (the shutdown waits for the callback). An error exit escalates the exit code of the shutdown.
+func (c *Closer) reentered(escalate bool) bool {
+	if !c.started.Load() || !c.inCallback() {
+		return false
+	}
+	if escalate {
+		c.mux.Lock()
+		c.escalated = true
+		c.mux.Unlock()
+	}
+	return true
+}
+
+// closeErr stores the error that caused the shutdown (if not nil) and closes with an error.
+func (c *Closer) closeErr(err error) {
+	if err != nil {
+		c.recordErr(err)
+	}
+	if c.reentered(true) {
+		return
+	}
+	c.startWaiting()
+	c.closeOnce.Do(func() {
+		close(c.errChan)
+	})
+	c.awaitExit()
+}
+
+// awaitExit waits for the shutdown to complete, unless the closer is running the callbacks (of the
+// shutdown or a reload) that may have made the request, the close request is made anyway then.
+func (c *Closer) awaitExit() {
+	if c.inCallback() {
+		return
+	}
+	<-c.exitedChan
+}
+
+// Init allows user to override the defaults (a set of OS signals to watch for, for example).
+// Empty cfg.ExitSignals means no signals are watched for.
+func Init(cfg Config) {
+	// the first use creates the default closer configured by cfg right away
+	created := false
+	stdOnce.Do(func() {
+		stdCloser = newCloser(cfg, true, false)
+		created = true
+	})
+	if !created {
+		stdCloser.Init(cfg)
+	}
+}
+
+// Init is the same as the package-level Init but for this closer.
+func (c *Closer) Init(cfg Config) {
+	c.sem.Lock()
+	c.fromVars = false
+	signal.Stop(c.signalChan)
+	// every waiting goroutine gets its own channel to be cancelled with,
+	// so Init may be called any number of times
+	close(c.cancelWaitChan)
+	c.cancelWaitChan = make(chan struct{})
+	c.configure(cfg)
+	go c.wait(c.cancelWaitChan)
+	c.sem.Unlock()
+}
+
+// Bind will register the cleanup function that will be called when closer will get a close request.
+// All the callbacks will be called in the reverse order they were bound, that's similar to how `defer` works,
+// unless Config.CleanupOrder is FIFO. The order is that of binding whatever the Bind function used.
+// It's too late to bind a callback once the shutdown has started, so it's called right away then
+// and that's logged as a warning, see BindE.
+//
+// It's safe to bind from the init of any package, whatever the order the packages get initialized in:
+// the callbacks bound before Init or SetSignals are kept by them. As Go initializes the imported packages
+// first, their callbacks are bound earlier and so are called after those bound by the importer (in LIFO order).
+//
+// The callbacks run as the signals keep arriving, so a blocking syscall made by one of them outside of the Go
+// runtime (via CGo or syscall.Syscall) may fail with EINTR, which such a callback must retry itself. The file
+// operations of the closer itself (the pid file, the exit reason, the clean shutdown flag) do retry.
+func Bind(cleanup func()) {
+	std().bind("", "", cleanup)
+}
+
+// Bind is the same as the package-level Bind but for this closer.
+func (c *Closer) Bind(cleanup func()) {
+	c.bind("", "", cleanup)
+}
+
+// BindE is the same as Bind, but it returns ErrShuttingDown if the shutdown has already started,
+// instead of calling the callback right away.
+func BindE(cleanup func()) error {
+	return std().BindE(cleanup)
+}
+
+// BindE is the same as the package-level BindE but for this closer.
+func (c *Closer) BindE(fn func()) error {
+	return c.storeCleanup(cleanup{fn: plain(fn)})
+}
+
+// BindNamed will register the named cleanup function just like Bind does, it returns the handle the callback can be
+// disabled (and enabled back) with until the shutdown, e.g. if a feature flag says so. The disabled callbacks are skipped.
+func BindNamed(name string, cleanup func()) *Handle {
+	return std().BindNamed(name, cleanup)
+}
+
+// BindNamed is the same as the package-level BindNamed but for this closer.
+func (c *Closer) BindNamed(name string, fn func()) *Handle {
+	h := &Handle{owner: c, name: name}
+	c.bindCleanup(cleanup{name: name, handle: h, fn: plain(fn)})
+	return h
+}
+
+// BindChild will register the cleanup function as a child of the callback referred to by parent, so it will
+// be called before the parent, all the children being called before their parent, like the dependents are closed
+// before their dependencies. The returned handle may be the parent of other callbacks in turn, which builds a tree
+// called leaves first. The siblings keep the order of Bind. It panics if parent has been bound to another closer.
+func BindChild(parent *Handle, cleanup func()) *Handle {
+	return std().BindChild(parent, cleanup)
+}
+
+// BindChild is the same as the package-level BindChild but for this closer.
+func (c *Closer) BindChild(parent *Handle, fn func()) *Handle {
+	if parent == nil || parent.owner != c {
+		panic("closer: the parent of BindChild belongs to another closer")
+	}
+	h := &Handle{owner: c}
+	c.bindCleanup(cleanup{handle: h, parent: parent, fn: plain(fn)})
+	return h
+}
+
+// BindWithContext will register the cleanup function for as long as ctx is live, e.g. for a resource
+// scoped to a request or a session: the callback is unbound as ctx is done, so it's not called then.
+// Nothing is bound if ctx is already done.
+func BindWithContext(ctx context.Context, cleanup func()) {
+	std().BindWithContext(ctx, cleanup)
+}
+
+// BindWithContext is the same as the package-level BindWithContext but for this closer.
+func (c *Closer) BindWithContext(ctx context.Context, fn func()) {
+	if ctx.Err() != nil {
+		return
+	}
+	h := &Handle{owner: c}
+	c.bindCleanup(cleanup{handle: h, fn: plain(fn)})
+	// no goroutine per binding, unbind does nothing once the shutdown has started
+	context.AfterFunc(ctx, func() { c.unbind(h) })
+}
+
+// BindErrGroupContext will tie the context of a group of goroutines, such as the one of errgroup.WithContext,
+// to the closer both ways: the shutdown calls cancel, while ctx cancelled with a cause (that is the first error
+// of the group) other than context.Canceled requests the close with the cause, like CloseErr does. A ctx done
+// as the shutdown has started doesn't request it again.
+//
+//	g, ctx := errgroup.WithContext(context.Background())
+//	ctx, cancel := context.WithCancel(ctx)
+//	closer.BindErrGroupContext(ctx, cancel)
+//	g.Go(func() error { return serve(ctx) })
+func BindErrGroupContext(ctx context.Context, cancel context.CancelFunc) {
+	std().BindErrGroupContext(ctx, cancel)
+}
+
+// BindErrGroupContext is the same as the package-level BindErrGroupContext but for this closer.
+func (c *Closer) BindErrGroupContext(ctx context.Context, cancel context.CancelFunc) {
+	go func() {
+		select {
+		case <-c.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+			if cause := context.Cause(ctx); !c.IsClosing() && !errors.Is(cause, context.Canceled) {
+				c.closeErr(cause)
+			}
+		}
+	}()
+}
+
+// unbind removes the callback bound with the handle.
+func (c *Closer) unbind(h *Handle) {
+	c.sem.Lock()
+	defer c.sem.Unlock()
+	if c.IsClosing() {
+		return
+	}
+	for i, cb := range c.cleanups {
+		if cb.handle == h {
+			c.cleanups = append(c.cleanups[:i:i], c.cleanups[i+1:]...)
+			return
+		}
+	}
+}
+
+// BindSignal will register the cleanup function that will be called only if the shutdown was caused
+// by the given signal or has failed (an error, e.g. Fatalln or CloseErr, or a panic), along with the callbacks
+// bound via Bind and in the same order. If the signal is
+// not watched for, the callback would never be called, so that's logged as a warning. Note that some
+// signals may never arrive though watched, e.g. SIGQUIT is sent by Ctrl+\ only if there's a terminal,
+// see Config.FoldSignalCleanups for that case.
+func BindSignal(sig os.Signal, cleanup func()) {
+	std().BindSignal(sig, cleanup)
+}
+
+// BindSignal is the same as the package-level BindSignal but for this closer.
+func (c *Closer) BindSignal(sig os.Signal, fn func()) {
+	c.bindCleanup(cleanup{signal: sig, fn: plain(fn)})
+}
+
+// SignalRule configures the shutdown caused by a signal, see On.
+type SignalRule struct {
+	c   *Closer
+	sig os.Signal
+}
+
+// On starts the configuration of the shutdown caused by the signal, so all of it reads as one chain:
+//
+//	closer.On(syscall.SIGTERM).Run(flush).ExitCode(0)
+//	closer.On(syscall.SIGQUIT).Run(dump).ExitCode(3)
+//
+// The signal must be watched for, as BindSignal tells.
+func On(sig os.Signal) *SignalRule {
+	return std().On(sig)
+}
+
+// On is the same as the package-level On but for this closer.
+func (c *Closer) On(sig os.Signal) *SignalRule {
+	return &SignalRule{c: c, sig: sig}
+}
+
+// Run binds the cleanup to the signal, the same as BindSignal does.
+func (r *SignalRule) Run(fn func()) *SignalRule {
+	r.c.BindSignal(r.sig, fn)
+	return r
+}
+
+// ExitCode sets the exit code of the shutdown caused by the signal, instead of ExitCodeOK. A timeout still
+// makes it ExitCodeErr, and BindOnSuccess callbacks only run if it's ExitCodeOK. The last one set wins.
+func (r *SignalRule) ExitCode(code int) *SignalRule {
+	r.c.mux.Lock()
+	if r.c.sigCodes == nil {
+		r.c.sigCodes = make(map[os.Signal]int)
+	}
+	r.c.sigCodes[r.sig] = code
+	r.c.mux.Unlock()
+	return r
+}
+
+// RunSignalCleanups calls the callbacks bound to the signal via BindSignal right away, as the shutdown caused
+// by the signal would, and returns their aggregated error, but it doesn't exit. The callbacks are unbound,
+// so they're not called again at shutdown. It's useful to test the order of the callbacks or to run a subset
+// of the teardown. It does nothing if no callbacks are bound to the signal and returns ErrShuttingDown
+// if the shutdown has started.
+func RunSignalCleanups(sig os.Signal) error {
+	return std().RunSignalCleanups(sig)
+}
+
+// RunSignalCleanups is the same as the package-level RunSignalCleanups but for this closer.
+func (c *Closer) RunSignalCleanups(sig os.Signal) error {
+	c.sem.Lock()
+	if c.IsClosing() {
+		c.sem.Unlock()
+		return ErrShuttingDown
+	}
+	var list, rest []cleanup
+	for _, cb := range c.cleanups {
+		if sig != nil && cb.signal == sig {
+			list = append(list, cb)
+		} else {
+			rest = append(rest, cb)
+		}
+	}
+	c.cleanups = rest
+	list = c.sortCleanups(list)
+	c.sem.Unlock()
+	// the callbacks are free to bind more
+	var errs []error
+	for _, cb := range list {
+		if cb.handle != nil && !cb.handle.Enabled() {
+			continue
+		}
+		if err := cb.callLogged(c, c.valuesContext(), sig); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return cleanupFailed(errs)
+}
+
+// checkWatched warns if the callbacks bound to the signal will never be called. The caller must hold c.sem.
+func (c *Closer) checkWatched(sig os.Signal) {
+	if c.fold {
+		return
+	}
+	for _, s := range c.signals {
+		if s == sig {
+			return
+		}
+	}
+	c.log(LevelWarn, "unwatched_signal", "cleanups are bound to "+SignalName(sig)+" which is not watched for", "signal", SignalName(sig))
+}
+
+// OnOtherSignal sets the hook that will be called with the received signal if it caused the shutdown
+// and no callbacks have been bound to it specifically via BindSignal, so the app may log or branch on
+// the signals it doesn't handle explicitly. The hook is called before the cleanups.
+func OnOtherSignal(fn func(sig os.Signal)) {
+	std().OnOtherSignal(fn)
+}
+
+// OnOtherSignal is the same as the package-level OnOtherSignal but for this closer.
+func (c *Closer) OnOtherSignal(fn func(sig os.Signal)) {
+	if !c.lockHooks("OnOtherSignal") {
+		return
+	}
+	c.onOther = fn
+	c.sem.Unlock()
+}
+
+// BindCtx will register the cleanup function just like Bind does, but the function gets a context
+// that's done once the ShutdownTimeout elapses, so it may give up on time.
+func BindCtx(cleanup func(ctx context.Context)) {
+	std().BindCtx(cleanup)
+}
+
+// BindCtx is the same as the package-level BindCtx but for this closer.
+func (c *Closer) BindCtx(fn func(ctx context.Context)) {
+	c.bindCleanup(cleanup{fn: func(ctx context.Context, _ os.Signal) error {
+		fn(ctx)
+		return nil
+	}})
+}
+
+// BindErr will register the cleanup function just like Bind does, but the function may fail. Its error is
+// logged and aggregated as the cleanup error, same as a panic in a callback (see Shutdown).
+func BindErr(cleanup func() error) {
+	std().BindErr(cleanup)
+}
+
+// BindErr is the same as the package-level BindErr but for this closer.
+func (c *Closer) BindErr(fn func() error) {
+	c.bindCleanup(cleanup{fn: func(context.Context, os.Signal) error {
+		return fn()
+	}})
+}
+
+// BindWorkerPool will register the cleanup function that stops a pool of workers fed via jobs: it closes jobs,
+// so no more jobs are taken, and waits for the workers to drain it, that is for the workers wait group, as long
+// as the timeout (if not zero) or the cleanup context allow. The workers not done in time make the cleanup fail.
+func BindWorkerPool[T any](jobs chan<- T, workers *sync.WaitGroup, timeout time.Duration) {
+	std().BindWorkerPool(func() { close(jobs) }, workers, timeout)
+}
+
+// BindWorkerPool is the same as the package-level BindWorkerPool but for this closer, stop is to close
+// the jobs channel, e.g. func() { close(jobs) }, as the methods can't be generic.
+func (c *Closer) BindWorkerPool(stop func(), workers *sync.WaitGroup, timeout time.Duration) {
+	c.bindCleanup(cleanup{fn: func(ctx context.Context, _ os.Signal) error {
+		stop()
+		drained := make(chan struct{})
+		go func() {
+			workers.Wait()
+			close(drained)
+		}()
+		var expired <-chan time.Time
+		if timeout > 0 {
+			timer := c.clock.NewTimer(timeout)
+			defer timer.Stop()
+			expired = timer.C()
+		}
+		select {
+		case <-drained:
+			return nil
+		case <-expired:
+			return fmt.Errorf("workers not drained within %v", timeout)
+		case <-ctx.Done():
+			return fmt.Errorf("workers not drained: %w", ctx.Err())
+		}
+	}})
+}
+
+// BindSig will register the cleanup function just like Bind does, but the function gets the signal
+// that caused the shutdown, or nil if it wasn't a signal.
+func BindSig(cleanup func(sig os.Signal)) {
+	std().BindSig(cleanup)
+}
+
+// BindSig is the same as the package-level BindSig but for this closer.
+func (c *Closer) BindSig(fn func(sig os.Signal)) {
+	c.bindCleanup(cleanup{fn: func(_ context.Context, sig os.Signal) error {
+		fn(sig)
+		return nil
+	}})
+}
+
+// BindOnError will register the callback that will be called only if the shutdown was caused by an error
+// or a panic, which is passed along with the cause. These callbacks are called after all the regular cleanups,
+// in the reverse order they were bound.
+func BindOnError(fn func(cause ShutdownCause, err error)) {
+	std().BindOnError(fn)
+}
+
+// BindOnError is the same as the package-level BindOnError but for this closer.
+func (c *Closer) BindOnError(fn func(cause ShutdownCause, err error)) {
+	if !c.lockHooks("BindOnError") {
+		return
+	}
+	c.onError = append([]func(ShutdownCause, error){fn}, c.onError...)
+	c.sem.Unlock()
+}
+
+// BindOnSuccess will register the callback that will be called only on a clean shutdown, i.e. caused by
+// a signal or a programmatic close request, and only if the exit code is still ExitCodeOK (so it's skipped if
+// the ShutdownTimeout elapses). Note that it's ExitCodeOK that counts, whatever it's set to, not zero.
+// These callbacks are called after all the regular cleanups, in the reverse order they were bound.
+func BindOnSuccess(fn func()) {
+	std().BindOnSuccess(fn)
+}
+
+// BindOnSuccess is the same as the package-level BindOnSuccess but for this closer.
+func (c *Closer) BindOnSuccess(fn func()) {
+	if !c.lockHooks("BindOnSuccess") {
+		return
+	}
+	c.onSuccess = append([]func(){fn}, c.onSuccess...)
+	c.sem.Unlock()
+}
+
+// BindWithErrors will register the callback that is called after all the cleanup callbacks (and those bound via
+// BindMainThread) with their errors, e.g. to record a degraded shutdown. The errors are empty if all of them
+// succeeded, a timeout is reported as the one error wrapping ErrShutdownTimeout. These callbacks are called before
+// those bound via BindOnError, BindOnSuccess and BindAlways and SetFinalFlush, in the reverse order they were bound,
+// each gets its own copy of the errors.
+func BindWithErrors(fn func(errs []error)) {
+	std().BindWithErrors(fn)
+}
+
+// BindWithErrors is the same as the package-level BindWithErrors but for this closer.
+func (c *Closer) BindWithErrors(fn func(errs []error)) {
+	if !c.lockHooks("BindWithErrors") {
+		return
+	}
+	c.withErrors = append([]func(errs []error){fn}, c.withErrors...)
+	c.sem.Unlock()
+}
+
+// runWithErrors calls the callbacks bound via BindWithErrors with the errors of err, the result of the cleanups.
+// The caller must hold c.sem.
+func (c *Closer) runWithErrors(err error) {
+	var errs []error
+	var failed cleanupError
+	if errors.As(err, &failed) {
+		if joined, ok := failed.err.(interface{ Unwrap() []error }); ok {
+			errs = joined.Unwrap()
+		}
+	} else if err != nil {
+		errs = []error{err}
+	}
+	for _, fn := range c.withErrors {
+		fn, errs := fn, append([]error(nil), errs...)
+		c.callHook("BindWithErrors", func() { fn(errs) })
+	}
+}
+
+// BindAlways will register the callback that must run whatever happens, e.g. to release a distributed lock.
+// These callbacks are called at the very end of the shutdown, after all the other callbacks, in the reverse order
+// they were bound, whether the shutdown was caused by an error, a panic, the cleanups failed or timed out. They're
+// called before a forced exit too (see ForceExit). Nothing can be called if the app is killed (e.g. by SIGKILL),
+// or exits bypassing the closer (os.Exit, HardExit) or crashes on an unrecovered panic in another goroutine.
+func BindAlways(fn func()) {
+	std().BindAlways(fn)
+}
+
+// BindAlways is the same as the package-level BindAlways but for this closer.
+func (c *Closer) BindAlways(fn func()) {
+	if !c.lockHooks("BindAlways") {
+		return
+	}
+	c.onAlways = append([]func(){fn}, c.onAlways...)
+	c.sem.Unlock()
+}
+
+// runAlways calls the callbacks bound via BindAlways, only the first call does. The caller must hold c.sem.
+func (c *Closer) runAlways() {
+	c.alwaysOnce.Do(func() {
+		for _, fn := range c.onAlways {
+			c.callHook("BindAlways", fn)
+		}
+	})
+}
+
+// BindAfter will register the named cleanup function that will be called only after the cleanup
+// named dependsOn has been called. Dependencies on names that were never bound are ignored, the other
+// callbacks keep the order of Bind. If the dependencies form a cycle, it will be logged and
+// the callbacks involved will be called in the order they were registered.
+func BindAfter(name string, dependsOn string, fn func()) {
+	std().bind(name, dependsOn, fn)
+}
+
+// BindAfter is the same as the package-level BindAfter but for this closer.
+func (c *Closer) BindAfter(name string, dependsOn string, fn func()) {
+	c.bind(name, dependsOn, fn)
+}
+
+func (c *Closer) bind(name, dependsOn string, fn func()) {
+	c.bindCleanup(cleanup{name: name, dependsOn: dependsOn, fn: plain(fn)})
+}
+
+// bindCleanup stores the callback. If the shutdown has already started, it's too late for that,
+// so the callback is called right away (if it applies to the shutdown), which is logged as a warning.
+func (c *Closer) bindCleanup(cb cleanup) {
+	if err := c.storeCleanup(cb); err == nil {
+		return
+	}
+	c.log(LevelWarn, "late_bind", "cleanup bound after the shutdown has started, calling it right away", "callback", cb.name)
+	if sig, failed := c.trigger(); c.applies(cb, sig, failed) {
+		cb.callLogged(c, c.valuesContext(), sig)
+	}
+}
+
+// lockHooks locks c.sem to set the hook, unless the shutdown has started: the hooks are in use then and
+// a cleanup setting one would deadlock, so that's logged as a warning and the hook is ignored.
+func (c *Closer) lockHooks(name string) bool {
+	if !c.IsClosing() {
+		c.sem.Lock()
+		if !c.IsClosing() {
+			return true
+		}
+		c.sem.Unlock()
+	}
+	c.log(LevelWarn, "late_hook", name+" called after the shutdown has started, ignored", "hook", name)
+	return false
+}
+
+// storeCleanup stores the callback, unless the shutdown has started, that's ErrShuttingDown. A callback
+// bound to a signal is checked to be watched for.
+func (c *Closer) storeCleanup(cb cleanup) error {
+	if c.IsClosing() {
+		return ErrShuttingDown
+	}
+	c.sem.Lock()
+	defer c.sem.Unlock()
+	if c.IsClosing() {
+		return ErrShuttingDown
+	}
+	c.seq++
+	cb.seq = c.seq
+	c.cleanups = append(c.cleanups, cb)
+	if cb.signal != nil {
+		c.checkWatched(cb.signal)
+	}
+	return nil
+}
+
+// Checked runs the target function and checks for panics and errors it may yield. In case of panic or error, closer
+// will terminate the app with an error code, but either case it will call all the bound callbacks beforehand.
+// One can use this instead of `defer` if you need to care about errors and panics that always may happen.
+// This function optionally can emit log messages via standard `log` package.
+func Checked(target func() error, logging bool) {
+	std().Checked(target, logging)
+}
+
+// Checked is the same as the package-level Checked but for this closer.
+func (c *Closer) Checked(target func() error, logging bool) {
+	defer func() {
+		// check if there was a panic
+		if x := recover(); x != nil {
+			c.handlePanic(x, 4, logging)
+		}
+	}()
+	if err := target(); err != nil {
+		if logging && !c.debounced() {
+			c.log(LevelError, "error", fmt.Sprint("error: ", err), "error", err)
+		}
+		// close with an error
+		c.closeErr(err)
+	}
+}
+
+// panicStack returns up to 29 frames of the stacktrace, starting the offset frames up from its caller.
+// While panicking, it starts at the function that panicked instead, whatever deep the recover is.
+func panicStack(offset int) []StackFrame {
+	var buf [128]uintptr
+	all := buf[:runtime.Callers(2, buf[:])]
+	var pcs []uintptr
+	if offset < len(all) {
+		pcs = all[offset:]
+	}
+	for i, pc := range all {
+		if fn := runtime.FuncForPC(pc); fn != nil && fn.Name() == "runtime.gopanic" {
+			pcs = all[i+1:]
+			// the runtime frames raising the panic, e.g. runtime.sigpanic of a nil dereference
+			for len(pcs) > 0 && isRuntimeFrame(pcs[0]) {
+				pcs = pcs[1:]
+			}
+			break
+		}
+	}
+	var stack []StackFrame
+	for _, pc := range pcs {
+		if len(stack) == 29 {
+			break
+		}
+		stack = append(stack, newStackFrame(pc))
+	}
+	return stack
+}
+
+// isRuntimeFrame reports whether the program counter belongs to the runtime package.
+func isRuntimeFrame(pc uintptr) bool {
+	fn := runtime.FuncForPC(pc)
+	return fn != nil && strings.HasPrefix(fn.Name(), "runtime.")
+}
+
+// OnPanic will register the hook that will be called on a recovered panic (by Close, Exit, Recover or Checked)
+// with the recovered value and the stacktrace, before the panic is logged and the shutdown starts, e.g. to report
+// the crash. The hooks are called in the order they were bound, a panic in a hook is logged and doesn't stop
+// the shutdown.
+func OnPanic(fn func(recovered interface{}, stack []StackFrame)) {
+	std().OnPanic(fn)
+}
+
+// OnPanic is the same as the package-level OnPanic but for this closer.
+func (c *Closer) OnPanic(fn func(recovered interface{}, stack []StackFrame)) {
+	c.mux.Lock()
+	c.onPanic = append(c.onPanic, fn)
+	c.mux.Unlock()
+}
+
+func (c *Closer) runPanicHooks(x interface{}, stack []StackFrame) {
+	c.mux.Lock()
+	hooks := c.onPanic
+	c.mux.Unlock()
+	for _, fn := range hooks {
+		c.callHook("OnPanic", func() { fn(x, stack) })
+	}
+}
+
+// OnShutdownStart will register the hook that will be called with the cause as the shutdown starts, before
+// the ShutdownStarted channel is closed and the closer Context is done. The hooks are called in the order
+// they were bound.
+func OnShutdownStart(fn func(cause ShutdownCause)) {
+	std().OnShutdownStart(fn)
+}
+
+// OnShutdownStart is the same as the package-level OnShutdownStart but for this closer.
+func (c *Closer) OnShutdownStart(fn func(cause ShutdownCause)) {
+	if !c.lockHooks("OnShutdownStart") {
+		return
+	}
+	c.onStart = append(c.onStart, fn)
+	c.sem.Unlock()
+}
+
+// OnShutdownComplete sets the hook that will be called right before os.Exit with a summary of the shutdown:
+// the total time it took, the exit code, the number of cleanup callbacks run and the first error (or panic)
+// that caused the shutdown, if any. The hook is called on every exit path, including panics. If the shutdown
+// has timed out, the error lists the callbacks that haven't finished, see SkippedCleanups, joined to the error
+// that caused the shutdown if there's one.
+func OnShutdownComplete(fn func(total time.Duration, code int, ran int, firstErr error)) {
+	std().OnShutdownComplete(fn)
+}
+
+// OnShutdownComplete is the same as the package-level OnShutdownComplete but for this closer.
+func (c *Closer) OnShutdownComplete(fn func(total time.Duration, code int, ran int, firstErr error)) {
+	if !c.lockHooks("OnShutdownComplete") {
+		return
+	}
+	c.onComplete = fn
+	c.sem.Unlock()
+}
+
+// OnHalfwayTimeout sets the hook that will be called once half the ShutdownTimeout has elapsed with the cleanups
+// still running, with the number of the callbacks that remain, e.g. to alert before the shutdown times out.
+// It's not called if there's no ShutdownTimeout.
+func OnHalfwayTimeout(fn func(remaining int)) {
+	std().OnHalfwayTimeout(fn)
+}
+
+// OnHalfwayTimeout is the same as the package-level OnHalfwayTimeout but for this closer.
+func (c *Closer) OnHalfwayTimeout(fn func(remaining int)) {
+	if !c.lockHooks("OnHalfwayTimeout") {
+		return
+	}
+	c.onHalfway = fn
+	c.sem.Unlock()
+}
+
+// SetStackWriter sets where the stack traces of panics (and goroutine dumps) are written to, os.Stdout by default.
+// A buffered writer, i.e. having the Flush() error method like *bufio.Writer does, gets flushed right before
+// the exit, and so does the output of the standard logger.
+func SetStackWriter(w io.Writer) {
+	std().SetStackWriter(w)
+}
+
+// SetStackWriter is the same as the package-level SetStackWriter but for this closer.
+func (c *Closer) SetStackWriter(w io.Writer) {
+	c.mux.Lock()
+	c.stackOut = w
+	c.mux.Unlock()
+}
+
+func (c *Closer) stackWriter() io.Writer {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.stackOut
+}
+
+// flushOutput flushes the stack writer, the output of the standard logger, os.Stdout and os.Stderr
+// if they are buffered, i.e. have the Flush method (an os.File has nothing to flush).
+func (c *Closer) flushOutput() {
+	for _, w := range []io.Writer{c.stackWriter(), log.Writer(), os.Stdout, os.Stderr} {
+		if f, ok := w.(interface{ Flush() error }); ok {
+			f.Flush()
+		}
+	}
+}
+
+// Shutdown runs all the bound cleanup callbacks and returns their aggregated error (panics in callbacks are
+// recovered and turned into errors), but unlike Close it doesn't terminate the app. If ctx is done before
+// the callbacks return, Shutdown returns the context's error, the remaining callbacks are still called
+// in the background. Only the first close request triggers the cleanup, so Shutdown returns
+// ErrAlreadyShutDown if it has been already made (by Shutdown, Close or any other means).
+func Shutdown(ctx context.Context) error {
+	return std().Shutdown(ctx)
+}
+
+// Shutdown is the same as the package-level Shutdown but for this closer.
+func (c *Closer) Shutdown(ctx context.Context) error {
+	if c.reentered(false) {
+		return ErrShuttingDown
+	}
+	c.startWaiting()
+	var first bool
+	c.closeOnce.Do(func() {
+		first = true
+		close(c.shutdownChan)
+	})
+	if !first {
+		return ErrAlreadyShutDown
+	}
+	if c.inCallback() {
+		// the shutdown can't be waited for
+		return ErrShuttingDown
+	}
+	select {
+	case <-c.doneChan:
+		return c.cleanupErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ShutdownStarted returns the channel that gets closed as soon as the shutdown starts, before the cleanups,
+// so a health check may report the app isn't ready anymore by a non-blocking receive.
+func ShutdownStarted() <-chan struct{} {
+	return std().ShutdownStarted()
+}
+
+// ShutdownStarted is the same as the package-level ShutdownStarted but for this closer.
+func (c *Closer) ShutdownStarted() <-chan struct{} {
+	return c.startedChan
+}
+
+// SetPanicFormatter sets the function that renders the recovered value for the panic message that is logged,
+// e.g. to print the stack an error carries. By default it's formatted with %v.
+func SetPanicFormatter(fn func(recovered interface{}) string) {
+	std().SetPanicFormatter(fn)
+}
+
+// SetPanicFormatter is the same as the package-level SetPanicFormatter but for this closer.
+func (c *Closer) SetPanicFormatter(fn func(recovered interface{}) string) {
+	c.mux.Lock()
+	c.panicFmt = fn
+	c.mux.Unlock()
+}
+
+// panicMessage returns the message the panic is logged with, the formatter panicking falls back to %v.
+func (c *Closer) panicMessage(x interface{}) (msg string) {
+	c.mux.Lock()
+	format := c.panicFmt
+	c.mux.Unlock()
+	msg = fmt.Sprintf("%s%v", c.panicPrefix, x)
+	if format == nil {
+		return msg
+	}
+	defer func() {
+		recover()
+	}()
+	return c.panicPrefix + format(x)
+}
+
+// SetPanicClassifier sets the function that computes the exit code if the shutdown was caused by a panic,
+// given the recovered value, e.g. to exit with 2 on assertion panics and with 1 on the others. It's called
+// after the cleanups, before the error callbacks and the exit. By default the exit code is ExitCodeErr.
+// Note that even if it returns ExitCodeOK, the shutdown still counts as caused by a panic, so the callbacks
+// bound via BindOnError are called and the ones bound via BindOnSuccess are not.
+func SetPanicClassifier(fn func(recovered interface{}) int) {
+	std().SetPanicClassifier(fn)
+}
+
+// SetPanicClassifier is the same as the package-level SetPanicClassifier but for this closer.
+func (c *Closer) SetPanicClassifier(fn func(recovered interface{}) int) {
+	if !c.lockHooks("SetPanicClassifier") {
+		return
+	}
+	c.classify = fn
+	c.sem.Unlock()
+}
+
+// SetExitCodeHook sets the function that decides the final exit code given the one computed by the shutdown,
+// its cause and first error, e.g. to always exit with 0 on SIGTERM whatever the cleanups did. It's called once
+// all the callbacks (including those bound via BindAlways) have run, so it has the last word: it overrides
+// the code requested via Exit, returned by SetPanicClassifier or set by a timeout or failed cleanup alike.
+// Its result is the code reported by HoldResult, the logs and OnShutdownComplete, and passed to os.Exit.
+// Only a forced exit (see ForceExit) bypasses it. There's only one such function, the last set wins.
+func SetExitCodeHook(fn func(code int, cause ShutdownCause, err error) int) {
+	std().SetExitCodeHook(fn)
+}
+
+// SetExitCodeHook is the same as the package-level SetExitCodeHook but for this closer.
+func (c *Closer) SetExitCodeHook(fn func(code int, cause ShutdownCause, err error) int) {
+	if !c.lockHooks("SetExitCodeHook") {
+		return
+	}
+	c.codeHook = fn
+	c.sem.Unlock()
+}
+
+// Done returns the channel that gets closed once the shutdown is complete, i.e. all the cleanups have been called.
+func Done() <-chan struct{} {
+	return std().Done()
+}
+
+// Done is the same as the package-level Done but for this closer.
+func (c *Closer) Done() <-chan struct{} {
+	return c.doneChan
+}
+
+// Err returns the error of the shutdown once it's complete (see Done): the error (or panic) that caused it
+// joined with the aggregated error of the cleanups. It's nil before the shutdown completes.
+func Err() error {
+	return std().Err()
+}
+
+// Err is the same as the package-level Err but for this closer.
+func (c *Closer) Err() error {
+	select {
+	case <-c.doneChan:
+	default:
+		return nil
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return errors.Join(c.causeErr, c.cleanupErr)
+}
+
+// SetExitFunc replaces os.Exit the closer terminates the app with, so the tests may record the exit code
+// instead. See also the closertest package, closertest.GuardExit keeps a test binary from being
+// terminated by the default closer.
+func SetExitFunc(fn func(code int)) {
+	std().SetExitFunc(fn)
+}
+
+// releaseHold makes Hold return, as the app survives the shutdown.
+func (c *Closer) releaseHold() {
+	c.holdOnce.Do(func() {
+		close(c.holdChan)
+	})
+}
+
+// SetExitFunc is the same as the package-level SetExitFunc but for this closer.
+func (c *Closer) SetExitFunc(fn func(code int)) {
+	if !c.lockHooks("SetExitFunc") {
+		return
+	}
+	c.exit = fn
+	c.sem.Unlock()
+}
+
+// SendSignal delivers the signal to the closer as if it was received from the OS, whether it's watched
+// for or not, so the tests don't have to signal the process. Just like signal.Notify does, it doesn't
+// block and the signal is dropped if the closer isn't ready to receive it.
+func SendSignal(sig os.Signal) {
+	std().SendSignal(sig)
+}
+
+// SendSignal is the same as the package-level SendSignal but for this closer.
+func (c *Closer) SendSignal(sig os.Signal) {
+	select {
+	case c.signalChan <- sig:
+	default:
+	}
+}
+
+// SetSignalSource replaces the OS as the source of the signals with the channel, so the tests may feed
+// the signals deterministically: every signal sent to src is delivered to the closer (as a watched one or not),
+// unlike SendSignal waiting for the closer to receive it. Setting a source stops the OS notifier of the closer
+// (WatchedSignals is empty then), until SetSignalSource(nil) is called, which restores it.
+func SetSignalSource(src <-chan os.Signal) {
+	std().SetSignalSource(src)
+}
+
+// SetSignalSource is the same as the package-level SetSignalSource but for this closer.
+func (c *Closer) SetSignalSource(src <-chan os.Signal) {
+	c.sem.Lock()
+	defer c.sem.Unlock()
+	if c.sourceStop != nil {
+		close(c.sourceStop)
+		c.sourceStop = nil
+	}
+	signal.Stop(c.signalChan)
+	if src == nil {
+		c.watch()
+		return
+	}
+	stop := make(chan struct{})
+	c.sourceStop = stop
+	c.watch()
+	go func() {
+		for {
+			select {
+			case sig, ok := <-src:
+				if !ok {
+					return
+				}
+				select {
+				case c.signalChan <- sig:
+				case <-stop:
+					return
+				case <-c.doneChan:
+					return
+				}
+			case <-stop:
+				return
+			case <-c.doneChan:
+				return
+			}
+		}
+	}()
+}
+
+// Context returns the context of the closer, it's done as soon as the shutdown starts.
+func Context() context.Context {
+	return std().Context()
+}
+
+// Context is the same as the package-level Context but for this closer.
+func (c *Closer) Context() context.Context {
+	return c.ctx
+}
+
+// AfterShutdown arranges to call fn in its own goroutine as soon as the shutdown starts, like context.AfterFunc
+// does for Context: that's right after the OnShutdownStart hooks, concurrently with the cleanups, which don't wait
+// for it (use Bind for that). Calling the returned stop cancels the call unless it has started already.
+func AfterShutdown(fn func()) (stop func()) {
+	return std().AfterShutdown(fn)
+}
+
+// AfterShutdown is the same as the package-level AfterShutdown but for this closer.
+func (c *Closer) AfterShutdown(fn func()) (stop func()) {
+	cancel := context.AfterFunc(c.ctx, fn)
+	return func() {
+		cancel()
+	}
+}
+
+// SetBaseContext sets the context whose values the context of the closer (see Context) and those passed
+// to the callbacks (see BindCtx) carry, e.g. the attributes of the shutdown-time logs. It's context.Background
+// by default. The values of ctx only are taken: its cancellation doesn't trigger the shutdown, tie them with
+// BindErrGroupContext for that. It may be called any time, the contexts already returned see the new values.
+func SetBaseContext(ctx context.Context) {
+	std().SetBaseContext(ctx)
+}
+
+// SetBaseContext is the same as the package-level SetBaseContext but for this closer.
+func (c *Closer) SetBaseContext(ctx context.Context) {
+	c.base.Store(&ctx)
+}
+
+// valuesContext returns a context that is never done with the values of the base context.
+func (c *Closer) valuesContext() context.Context {
+	return baseContext{Context: context.Background(), c: c}
+}
+
+// baseContext is the context.Background with the values of the base context of the closer.
+type baseContext struct {
+	context.Context
+	c *Closer
+}
+
+func (b baseContext) Value(key interface{}) interface{} {
+	if base := b.c.base.Load(); base != nil {
+		return (*base).Value(key)
+	}
+	return nil
+}
+
+// SetFinalFlush sets the function that will be called after all the other callbacks and hooks but the one set
+// via OnShutdownComplete, right before os.Exit, e.g. to flush a buffered logger so the shutdown diagnostics actually get written.
+// There's only one such function, the last set wins.
+func SetFinalFlush(fn func()) {
+	std().SetFinalFlush(fn)
+}
+
+// SetFinalFlush is the same as the package-level SetFinalFlush but for this closer.
+func (c *Closer) SetFinalFlush(fn func()) {
+	if !c.lockHooks("SetFinalFlush") {
+		return
+	}
+	c.finalFlush = fn
+	c.sem.Unlock()
+}
+
+// Chain binds a cleanup callback to the default closer that shuts down the given closers one by one,
+// in the order they are passed, each one to completion. This way the modules may own their closers
+// while the shutdown of the app drives them. Their errors are those of the callback, so they count
+// as a failed cleanup of the default closer (see Err and FailCloseOnCleanupError).
+func Chain(closers ...*Closer) {
+	std().Chain(closers...)
+}
+
+// Chain is the same as the package-level Chain but for this closer.
+func (c *Closer) Chain(closers ...*Closer) {
+	c.BindErr(func() error {
+		var errs []error
+		for _, cl := range closers {
+			if err := cl.Shutdown(context.Background()); err != nil && err != ErrAlreadyShutDown {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	})
+}
+
+// ShutdownAll shuts down the closers created by NewCloser, one by one in the order they were created,
+// each one to completion (see Shutdown), and returns their aggregated error. The closers that have already
+// been shut down are skipped. The default closer calls it on its shutdown, after its own cleanups.
+func ShutdownAll(ctx context.Context) error {
+	registry.Lock()
+	closers := append([]*Closer(nil), registry.closers...)
+	registry.Unlock()
+	var errs []error
+	for _, cl := range closers {
+		if err := cl.Shutdown(ctx); err != nil && err != ErrAlreadyShutDown {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Stop stops the closer that hasn't been shut down, e.g. as the test using it ends: it stops watching for
+// the signals and waiting for the close requests, and it's no longer driven by ShutdownAll. The callbacks
+// bound to it are never called then. The closer must not be used after Stop.
+func (c *Closer) Stop() {
+	registry.Lock()
+	for i, cl := range registry.closers {
+		if cl == c {
+			registry.closers = append(registry.closers[:i:i], registry.closers[i+1:]...)
+			break
+		}
+	}
+	registry.Unlock()
+	c.sem.Lock()
+	defer c.sem.Unlock()
+	if c.started.Load() {
+		return
+	}
+	signal.Stop(c.signalChan)
+	if c.sourceStop != nil {
+		close(c.sourceStop)
+		c.sourceStop = nil
+	}
+	close(c.cancelWaitChan)
+	c.cancelWaitChan = make(chan struct{})
 }
 
 // Hold is a helper that may be used to hold the main from returning,
-// until the closer will do a proper exit via `os.Exit`.
+// until the closer will do a proper exit via `os.Exit`. It also runs the cleanups bound via BindMainThread.
+// If the process survives the shutdown (Shutdown, HoldResult, an exit overridden by SetExitFunc or
+// RepanicAfterCleanup), Hold returns once the shutdown has completed; see HoldResult for its outcome.
 func Hold() {
+	std().syncVars()
+	std().Hold()
+}
+
+// Hold is the same as the package-level Hold but for this closer.
+func (c *Closer) Hold() {
+	c.holding.Add(1)
+	c.log(LevelInfo, "hold", "holding the main", "ready", c.isReady())
+	select {
+	case fns := <-c.mainChan:
+		leave := c.enterCallbacks()
+		for _, fn := range fns {
+			c.callHook("BindMainThread", fn)
+		}
+		leave()
+		c.mainDone <- struct{}{}
+	case <-c.holdChan:
+		// no main thread cleanups
+		return
+	}
 	<-c.holdChan
 }
+
+// HoldResult blocks until the shutdown is complete and returns its exit code, cause and error (see Err),
+// but the closer doesn't exit then, leaving it up to the caller, e.g. to call os.Exit(code) or not in a library.
+// If ctx is done before the shutdown starts, it requests the close just like Close does. HoldResult is meant to be
+// called before the shutdown starts, otherwise the closer may exit before it returns.
+func HoldResult(ctx context.Context) (code int, cause ShutdownCause, err error) {
+	std().syncVars()
+	return std().HoldResult(ctx)
+}
+
+// HoldResult is the same as the package-level HoldResult but for this closer.
+func (c *Closer) HoldResult(ctx context.Context) (code int, cause ShutdownCause, err error) {
+	c.holdResult.Store(true)
+	select {
+	case <-c.exitedChan:
+	case <-ctx.Done():
+		c.startWaiting()
+		c.closeOnce.Do(func() {
+			close(c.closeChan)
+		})
+		<-c.exitedChan
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.exitCode, c.cause, errors.Join(c.causeErr, c.cleanupErr)
+}
+
+// Run runs fn as the body of the app and returns the exit code, so the main may be just os.Exit(closer.Run(run)).
+// The context of fn is done as the shutdown starts (see Context). Once fn returns, the error or panic it yields
+// is handled as by Checked (with logging) and the shutdown runs all the cleanups, so does a signal or a close
+// request meanwhile, but the closer doesn't exit (see HoldResult), Run returns the exit code instead.
+func Run(fn func(ctx context.Context) error) int {
+	std().syncVars()
+	return std().Run(fn)
+}
+
+// Run is the same as the package-level Run but for this closer.
+func (c *Closer) Run(fn func(ctx context.Context) error) int {
+	c.holdResult.Store(true)
+	go func() {
+		c.Checked(func() error {
+			return fn(c.ctx)
+		}, true)
+		c.close(nil)
+	}()
+	code, _, _ := c.HoldResult(context.Background())
+	return code
+}
+
+// BindMainThread will register the cleanup function that must run on the main OS thread, e.g. to release
+// some GUI, OpenGL or CGo resources. Such callbacks are called by Hold after all the regular cleanups, in
+// the reverse order they were bound. It requires Hold to be called from the main goroutine locked to the main
+// thread, that is runtime.LockOSThread called from an init function. If nobody's holding, the callbacks
+// are called along with the others, which is logged as a warning.
+func BindMainThread(fn func()) {
+	std().BindMainThread(fn)
+}
+
+// BindMainThread is the same as the package-level BindMainThread but for this closer.
+func (c *Closer) BindMainThread(fn func()) {
+	if !c.lockHooks("BindMainThread") {
+		return
+	}
+	c.onMain = append([]func(){fn}, c.onMain...)
+	c.sem.Unlock()
+}
+
+// runMainThread passes the main thread cleanups to Hold and waits for them. The caller must hold c.sem.
+func (c *Closer) runMainThread() {
+	if len(c.onMain) == 0 {
+		return
+	}
+	if c.holding.Load() > 0 {
+		c.mainChan <- c.onMain
+		<-c.mainDone
+		return
+	}
+	c.log(LevelWarn, "main_thread", "no Hold to run the main thread cleanups, running them in place")
+	for _, fn := range c.onMain {
+		c.callHook("BindMainThread", fn)
+	}
+}
@@ -0,0 +1,1012 @@
+package closer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// testTimeout bounds every wait of the tests.
+const testTimeout = 5 * time.Second
+
+// newTestCloser creates a closer that is not registered and doesn't exit the test binary,
+// the exit codes it would exit with are sent to the returned channel.
+func newTestCloser(t *testing.T, cfg Config) (*Closer, <-chan int) {
+	t.Helper()
+	c := newCloser(cfg, false, false)
+	codes := make(chan int, 4)
+	c.SetExitFunc(func(code int) {
+		codes <- code
+	})
+	t.Cleanup(c.Stop)
+	return c, codes
+}
+
+// waitExit returns the exit code sent to codes, failing the test if there's none in time.
+func waitExit(t *testing.T, codes <-chan int) int {
+	t.Helper()
+	select {
+	case code := <-codes:
+		return code
+	case <-time.After(testTimeout):
+		t.Fatal("no exit in time")
+		return 0
+	}
+}
+
+// waitChan fails the test if ch doesn't get closed (or receive) in time.
+func waitChan[T any](t *testing.T, ch <-chan T, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(testTimeout):
+		t.Fatalf("%s: timed out", what)
+	}
+}
+
+func TestReloadSignalIsNotTheShutdownSignal(t *testing.T) {
+	c, codes := newTestCloser(t, Config{ReloadSignals: []os.Signal{syscall.SIGHUP}})
+	reloaded := make(chan struct{}, 1)
+	c.BindReload(func() { reloaded <- struct{}{} })
+	got := make(chan os.Signal, 1)
+	c.BindSig(func(sig os.Signal) { got <- sig })
+	c.SendSignal(syscall.SIGHUP)
+	waitChan(t, reloaded, "reload")
+	go c.Close()
+	if code := waitExit(t, codes); code != 0 {
+		t.Errorf("exit code %d, want 0", code)
+	}
+	if sig := <-got; sig != nil {
+		t.Errorf("BindSig got %v, want nil", sig)
+	}
+	if sig := c.receivedSignal(); sig != nil {
+		t.Errorf("shutdown signal %v, want nil", sig)
+	}
+	if n := c.SignalCounts()[syscall.SIGHUP]; n != 1 {
+		t.Errorf("SIGHUP counted %d times, want 1", n)
+	}
+}
+
+func TestCloseErrFromCleanupEscalates(t *testing.T) {
+	c, codes := newTestCloser(t, Config{ExitCodeErr: 1})
+	after := make(chan struct{})
+	c.Bind(func() { close(after) })
+	c.Bind(func() { c.CloseErr(errors.New("deep trouble")) })
+	go c.Close()
+	if code := waitExit(t, codes); code != 1 {
+		t.Errorf("exit code %d, want 1", code)
+	}
+	waitChan(t, after, "the next cleanup")
+}
+
+func TestCloseErrDeepInCleanupEscalates(t *testing.T) {
+	c, codes := newTestCloser(t, Config{ExitCodeErr: 1})
+	var deep func(n int)
+	deep = func(n int) {
+		if n == 0 {
+			c.CloseErr(errors.New("deep trouble"))
+			return
+		}
+		deep(n - 1)
+	}
+	c.Bind(func() { deep(200) })
+	go c.Close()
+	if code := waitExit(t, codes); code != 1 {
+		t.Errorf("exit code %d, want 1", code)
+	}
+}
+
+func TestCloseErrFromCleanupGoroutine(t *testing.T) {
+	c, codes := newTestCloser(t, Config{ExitCodeErr: 1})
+	c.Bind(func() {
+		// the cleanup waits for the goroutine it has started
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			c.CloseErr(errors.New("worker failed"))
+		}()
+		<-done
+	})
+	go c.Close()
+	if code := waitExit(t, codes); code != 1 {
+		t.Errorf("exit code %d, want 1", code)
+	}
+}
+
+func TestCloseErrOfAnotherCloserFromCleanup(t *testing.T) {
+	a, aCodes := newTestCloser(t, Config{ExitCodeErr: 1})
+	b, bCodes := newTestCloser(t, Config{ExitCodeErr: 1})
+	a.Bind(func() { b.CloseErr(errors.New("b failed")) })
+	go a.Close()
+	if code := waitExit(t, bCodes); code != 1 {
+		t.Errorf("exit code of b %d, want 1", code)
+	}
+	if code := waitExit(t, aCodes); code != 0 {
+		t.Errorf("exit code of a %d, want 0", code)
+	}
+}
+
+func TestCloseErrFromReloadSignal(t *testing.T) {
+	c, codes := newTestCloser(t, Config{ExitCodeErr: 1, ReloadSignals: []os.Signal{syscall.SIGHUP}})
+	c.BindReload(func() { c.CloseErr(errors.New("invalid config")) })
+	c.SendSignal(syscall.SIGHUP)
+	if code := waitExit(t, codes); code != 1 {
+		t.Errorf("exit code %d, want 1", code)
+	}
+	if _, cause, _ := c.HoldResult(context.Background()); cause != CauseError {
+		t.Errorf("cause %v, want %v", cause, CauseError)
+	}
+}
+
+func TestCloseFromReload(t *testing.T) {
+	c, codes := newTestCloser(t, Config{})
+	c.BindReload(func() { c.Close() })
+	reloaded := make(chan struct{})
+	go func() {
+		c.Reload()
+		close(reloaded)
+	}()
+	waitChan(t, reloaded, "reload")
+	if code := waitExit(t, codes); code != 0 {
+		t.Errorf("exit code %d, want 0", code)
+	}
+}
+
+func TestForceExitOverriddenExitsOnce(t *testing.T) {
+	c, codes := newTestCloser(t, Config{ExitCodeErr: 1, SignalDuringCleanup: ForceExit})
+	reason := filepath.Join(t.TempDir(), "reason.json")
+	c.SetExitReasonFile(reason)
+	running := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	c.Bind(func() {
+		close(running)
+		<-release
+	})
+	c.SendSignal(syscall.SIGTERM)
+	waitChan(t, running, "cleanup")
+	c.SendSignal(syscall.SIGINT)
+	if code := waitExit(t, codes); code != 1 {
+		t.Errorf("exit code %d, want 1", code)
+	}
+	waitChan(t, c.exitedChan, "exited")
+	select {
+	case code := <-codes:
+		t.Errorf("exited again with %d", code)
+	case <-time.After(50 * time.Millisecond):
+	}
+	data, err := os.ReadFile(reason)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct{ Code int }
+	if err := json.Unmarshal(data, &got); err != nil || got.Code != 1 {
+		t.Errorf("exit reason %s, want code 1", data)
+	}
+}
+
+func TestBindSignalFromCleanup(t *testing.T) {
+	c, codes := newTestCloser(t, Config{})
+	called := make(chan struct{})
+	c.Bind(func() {
+		c.BindSignal(syscall.SIGTERM, func() { t.Error("signal cleanup called for Close") })
+		c.Bind(func() { close(called) })
+	})
+	go c.Close()
+	waitChan(t, called, "late cleanup")
+	waitExit(t, codes)
+}
+
+func TestSetHooksFromCleanup(t *testing.T) {
+	c, codes := newTestCloser(t, Config{})
+	done := make(chan struct{})
+	c.Bind(func() {
+		c.BindAlways(func() { t.Error("late BindAlways hook called") })
+		c.BindOnError(func(ShutdownCause, error) {})
+		c.BindOnSuccess(func() { t.Error("late BindOnSuccess hook called") })
+		c.BindWithErrors(func([]error) {})
+		c.OnShutdownComplete(func(time.Duration, int, int, error) {})
+		c.SetFinalFlush(func() { t.Error("late final flush called") })
+		c.SetExitFunc(func(int) { t.Error("late exit func called") })
+		c.OnShutdownStart(func(ShutdownCause) {})
+		c.OnHalfwayTimeout(func(int) {})
+		c.OnOtherSignal(func(os.Signal) {})
+		c.SetExitCodeHook(func(code int, _ ShutdownCause, _ error) int { return code + 1 })
+		c.SetPanicClassifier(func(interface{}) int { return 9 })
+		c.BindMainThread(func() { t.Error("late main thread callback called") })
+		close(done)
+	})
+	go c.Close()
+	waitChan(t, done, "cleanup")
+	if code := waitExit(t, codes); code != 0 {
+		t.Errorf("exit code %d, want 0", code)
+	}
+}
+
+func TestSnapshotDuringSetSignals(t *testing.T) {
+	c, codes := newTestCloser(t, Config{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			c.SetSignals(syscall.SIGHUP)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		c.Snapshot()
+	}
+	waitChan(t, done, "SetSignals")
+	if got := c.Snapshot().WatchedSignals; len(got) != 1 || got[0] != SignalName(syscall.SIGHUP) {
+		t.Errorf("watched signals %v, want SIGHUP", got)
+	}
+	go c.Close()
+	waitExit(t, codes)
+}
+
+func TestShutdownCompleteErrListsTimeout(t *testing.T) {
+	c, codes := newTestCloser(t, Config{ExitCodeErr: 1, ShutdownTimeout: 20 * time.Millisecond})
+	release := make(chan struct{})
+	defer close(release)
+	c.BindNamed("stuck", func() { <-release })
+	completeErr := make(chan error, 1)
+	c.OnShutdownComplete(func(_ time.Duration, _ int, _ int, err error) { completeErr <- err })
+	cause := errors.New("boom")
+	go c.CloseErr(cause)
+	waitExit(t, codes)
+	err := <-completeErr
+	if !errors.Is(err, cause) || !errors.Is(err, ErrShutdownTimeout) {
+		t.Errorf("complete error %v, want both the cause and the timeout", err)
+	}
+}
+
+// bindHeld binds a cleanup of every kind Hold waits for, the returned func tells which of them ran.
+func bindHeld(c *Closer) (ran func() []string) {
+	var mux sync.Mutex
+	var got []string
+	record := func(name string) func() {
+		return func() {
+			mux.Lock()
+			got = append(got, name)
+			mux.Unlock()
+		}
+	}
+	c.Bind(record("cleanup"))
+	c.BindSignal(syscall.SIGTERM, record("signal"))
+	c.BindMainThread(record("main"))
+	return func() []string {
+		mux.Lock()
+		defer mux.Unlock()
+		return got
+	}
+}
+
+func TestHoldReturnsOnGoexit(t *testing.T) {
+	c, codes := newTestCloser(t, Config{ExitStrategy: ExitGoexit, ExitSignals: []os.Signal{syscall.SIGTERM}})
+	ran := bindHeld(c)
+	held := make(chan struct{})
+	go func() {
+		defer close(held)
+		c.Hold()
+	}()
+	c.SendSignal(syscall.SIGTERM)
+	waitChan(t, held, "Hold")
+	select {
+	case code := <-codes:
+		t.Errorf("exited with %d, want Goexit", code)
+	default:
+	}
+	if want := []string{"signal", "cleanup", "main"}; !reflect.DeepEqual(ran(), want) {
+		t.Errorf("ran %v, want %v", ran(), want)
+	}
+}
+
+func TestHoldReturnsAfterExit(t *testing.T) {
+	c, codes := newTestCloser(t, Config{ExitSignals: []os.Signal{syscall.SIGTERM}})
+	ran := bindHeld(c)
+	held := make(chan struct{})
+	go func() {
+		defer close(held)
+		c.Hold()
+	}()
+	c.SendSignal(syscall.SIGTERM)
+	waitExit(t, codes)
+	waitChan(t, held, "Hold")
+	if want := []string{"signal", "cleanup", "main"}; !reflect.DeepEqual(ran(), want) {
+		t.Errorf("ran %v, want %v", ran(), want)
+	}
+}
+
+func TestHoldResult(t *testing.T) {
+	c, codes := newTestCloser(t, Config{ExitCodeErr: 3})
+	cause := errors.New("boom")
+	go c.CloseErr(cause)
+	code, gotCause, err := c.HoldResult(context.Background())
+	if code != 3 || gotCause != CauseError || !errors.Is(err, cause) {
+		t.Errorf("HoldResult = %d, %v, %v; want 3, %v, %v", code, gotCause, err, CauseError, cause)
+	}
+	select {
+	case code := <-codes:
+		t.Errorf("exited with %d, HoldResult must leave the exit to the caller", code)
+	default:
+	}
+}
+
+func TestHoldResultContextDone(t *testing.T) {
+	c, _ := newTestCloser(t, Config{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	code, cause, err := c.HoldResult(ctx)
+	if code != c.codeOK || cause != CauseClose || err != nil {
+		t.Errorf("HoldResult = %d, %v, %v; want a clean close", code, cause, err)
+	}
+}
+
+func TestCheckedErrorDebounced(t *testing.T) {
+	c, codes := newTestCloser(t, Config{ErrorDebounce: time.Hour})
+	logged := make(chan string, 4)
+	c.SetLogFunc(func(level, msg string, kv ...interface{}) {
+		if level == LevelError {
+			logged <- msg
+		}
+	})
+	go c.Checked(func() error { return errors.New("first") }, true)
+	waitExit(t, codes)
+	c.Checked(func() error { return errors.New("second") }, true)
+	if n := c.DebouncedErrors(); n != 1 {
+		t.Errorf("%d debounced errors, want 1", n)
+	}
+	if got := len(logged); got != 1 {
+		t.Errorf("%d errors logged, want 1", got)
+	}
+}
+
+func TestConcurrentClose(t *testing.T) {
+	c, codes := newTestCloser(t, Config{})
+	var calls atomic.Int32
+	c.Bind(func() { calls.Add(1) })
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Close()
+		}()
+	}
+	returned := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(returned)
+	}()
+	waitExit(t, codes)
+	waitChan(t, returned, "Close calls")
+	if n := calls.Load(); n != 1 {
+		t.Errorf("cleanup called %d times, want once", n)
+	}
+	select {
+	case code := <-codes:
+		t.Errorf("exited again with %d", code)
+	default:
+	}
+}
+
+func TestFatallnRunsAllCleanups(t *testing.T) {
+	c, codes := newTestCloser(t, Config{ExitCodeErr: 4, ExitSignals: []os.Signal{syscall.SIGTERM, syscall.SIGQUIT}})
+	var calls atomic.Int32
+	for i := 0; i < 3; i++ {
+		c.Bind(func() { calls.Add(1) })
+	}
+	c.BindSignal(syscall.SIGTERM, func() { calls.Add(1) })
+	c.BindSignal(syscall.SIGQUIT, func() { calls.Add(1) })
+	go c.Fatalln("fatal")
+	if code := waitExit(t, codes); code != 4 {
+		t.Errorf("exit code %d, want 4", code)
+	}
+	if n := calls.Load(); n != 5 {
+		t.Errorf("%d cleanups called, want all 5 including the signal ones", n)
+	}
+	if err := c.Err(); err == nil || err.Error() != "fatal" {
+		t.Errorf("Err() = %v, want fatal", err)
+	}
+}
+
+// stackError is an error that prints its stack with %+v, like the errors of the stack-tracing packages.
+type stackError struct{ msg string }
+
+func (e stackError) Error() string { return e.msg }
+
+func (e stackError) Format(s fmt.State, verb rune) {
+	if verb == 'v' && s.Flag('+') {
+		fmt.Fprint(s, e.msg+"\n\tat main.run")
+		return
+	}
+	fmt.Fprint(s, e.msg)
+}
+
+// panicLogged runs a panicking Checked with the formatter and returns the logged panic message.
+func panicLogged(t *testing.T, format func(recovered interface{}) string) string {
+	t.Helper()
+	c, codes := newTestCloser(t, Config{})
+	c.SetPanicFormatter(format)
+	logged := make(chan string, 1)
+	c.SetLogFunc(func(level, msg string, kv ...interface{}) {
+		if len(kv) > 1 && kv[1] == "panic" {
+			logged <- msg
+		}
+	})
+	go c.Checked(func() error { panic(stackError{"boom"}) }, true)
+	waitExit(t, codes)
+	return <-logged
+}
+
+func TestPanicFormatter(t *testing.T) {
+	got := panicLogged(t, func(x interface{}) string { return fmt.Sprintf("%+v", x) })
+	if want := DefaultPanicLogPrefix + "boom\n\tat main.run"; got != want {
+		t.Errorf("panic logged as %q, want %q", got, want)
+	}
+}
+
+func TestPanicFormatterPanics(t *testing.T) {
+	got := panicLogged(t, func(interface{}) string { panic("formatter") })
+	if want := DefaultPanicLogPrefix + "boom"; got != want {
+		t.Errorf("panic logged as %q, want %q", got, want)
+	}
+}
+
+func TestCloseReturnsAfterExit(t *testing.T) {
+	for name, request := range map[string]func(c *Closer){
+		"Close":    func(c *Closer) { c.Close() },
+		"CloseErr": func(c *Closer) { c.CloseErr(errors.New("boom")) },
+		"Exit":     func(c *Closer) { c.Exit(3) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, codes := newTestCloser(t, Config{})
+			c.Bind(func() { time.Sleep(10 * time.Millisecond) })
+			returned := make(chan struct{})
+			go func() {
+				defer close(returned)
+				request(c)
+			}()
+			waitChan(t, returned, name)
+			select {
+			case <-codes:
+			default:
+				t.Errorf("%s returned before the exit", name)
+			}
+		})
+	}
+}
+
+func TestOnPanicFromChecked(t *testing.T) {
+	c, codes := newTestCloser(t, Config{ExitCodeErr: 1})
+	got := make(chan interface{}, 1)
+	var frames []StackFrame
+	c.OnPanic(func(x interface{}, stack []StackFrame) {
+		frames = stack
+		got <- x
+	})
+	go c.Checked(func() error { panic("boom") }, false)
+	if code := waitExit(t, codes); code != 1 {
+		t.Errorf("exit code %d, want 1", code)
+	}
+	if x := <-got; x != "boom" {
+		t.Errorf("OnPanic got %v, want boom", x)
+	}
+	if len(frames) == 0 || !strings.Contains(frames[0].Name, "TestOnPanicFromChecked") {
+		t.Errorf("OnPanic got the stack %v, want it to start at the panicking function", frames)
+	}
+	for _, f := range frames {
+		if strings.Contains(f.Name, "handlePanic") || strings.Contains(f.Name, "panicStack") {
+			t.Errorf("OnPanic got the frames of the panic handling: %v", frames)
+			break
+		}
+	}
+}
+
+func TestOnPanicFromRecoverRuntimeError(t *testing.T) {
+	c, codes := newTestCloser(t, Config{ExitCodeErr: 1})
+	var frames []StackFrame
+	c.OnPanic(func(x interface{}, stack []StackFrame) { frames = stack })
+	go func() {
+		defer c.Recover()
+		var m map[string]int
+		var p *int
+		m["a"] = *p
+	}()
+	waitExit(t, codes)
+	if len(frames) == 0 || !strings.Contains(frames[0].Name, "TestOnPanicFromRecoverRuntimeError") {
+		t.Errorf("OnPanic got the stack %v, want it to start at the panicking function", frames)
+	}
+}
+
+func TestShutdownStepOrder(t *testing.T) {
+	c, _ := newTestCloser(t, Config{})
+	var mux sync.Mutex
+	var steps []string
+	step := func(name string) {
+		mux.Lock()
+		steps = append(steps, name)
+		mux.Unlock()
+	}
+	c.OnShutdownStart(func(ShutdownCause) {
+		select {
+		case <-c.ShutdownStarted():
+			step("start after ShutdownStarted")
+		default:
+			step("start")
+		}
+	})
+	c.Bind(func() {
+		if c.Context().Err() != nil {
+			step("cleanup")
+		}
+	})
+	c.BindWithErrors(func([]error) { step("with errors") })
+	c.BindOnError(func(ShutdownCause, error) { step("error") })
+	c.BindOnSuccess(func() { step("success") })
+	c.BindAlways(func() { step("always") })
+	reason := filepath.Join(t.TempDir(), "reason.json")
+	c.SetExitReasonFile(reason)
+	c.SetFinalFlush(func() {
+		if _, err := os.Stat(reason); err != nil {
+			step("final flush before the exit reason")
+			return
+		}
+		step("final flush")
+	})
+	c.OnShutdownComplete(func(time.Duration, int, int, error) { step("complete") })
+	exited := make(chan struct{})
+	c.SetExitFunc(func(int) {
+		step("exit")
+		close(exited)
+	})
+	go c.Close()
+	waitChan(t, exited, "exit")
+	mux.Lock()
+	defer mux.Unlock()
+	want := []string{"start", "cleanup", "with errors", "success", "always", "final flush", "complete", "exit"}
+	if !reflect.DeepEqual(steps, want) {
+		t.Errorf("steps %q, want %q", steps, want)
+	}
+}
+
+// group is a minimal errgroup: the first error of the goroutines cancels the context with it.
+type group struct {
+	wg     sync.WaitGroup
+	once   sync.Once
+	cancel context.CancelCauseFunc
+}
+
+func newGroup() (*group, context.Context) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	return &group{cancel: cancel}, ctx
+}
+
+func (g *group) Go(fn func() error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := fn(); err != nil {
+			g.once.Do(func() { g.cancel(err) })
+		}
+	}()
+}
+
+func TestErrGroupErrorClosesWithCause(t *testing.T) {
+	c, codes := newTestCloser(t, Config{ExitCodeErr: 1})
+	g, ctx := newGroup()
+	ctx, cancel := context.WithCancel(ctx)
+	c.BindErrGroupContext(ctx, cancel)
+	failed := errors.New("serve failed")
+	g.Go(func() error { return failed })
+	if code := waitExit(t, codes); code != 1 {
+		t.Errorf("exit code %d, want 1", code)
+	}
+	if err := c.Err(); !errors.Is(err, failed) {
+		t.Errorf("Err() = %v, want %v", err, failed)
+	}
+}
+
+func TestShutdownCancelsErrGroup(t *testing.T) {
+	c, codes := newTestCloser(t, Config{})
+	g, ctx := newGroup()
+	ctx, cancel := context.WithCancel(ctx)
+	c.BindErrGroupContext(ctx, cancel)
+	g.Go(func() error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	go c.Close()
+	if code := waitExit(t, codes); code != 0 {
+		t.Errorf("exit code %d, want 0", code)
+	}
+	stopped := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(stopped)
+	}()
+	waitChan(t, stopped, "group")
+	if err := c.Err(); err != nil {
+		t.Errorf("Err() = %v, the group stopped by the shutdown must not fail it", err)
+	}
+}
+
+func TestErrGroupCanceledDoesNotClose(t *testing.T) {
+	c, codes := newTestCloser(t, Config{})
+	ctx, cancel := context.WithCancel(context.Background())
+	c.BindErrGroupContext(ctx, cancel)
+	cancel()
+	select {
+	case code := <-codes:
+		t.Errorf("exited with %d on a plain cancel", code)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestForceExitCompletesBeforeExit(t *testing.T) {
+	c, _ := newTestCloser(t, Config{ExitCodeErr: 1, SignalDuringCleanup: ForceExit})
+	var flushed, completed atomic.Bool
+	c.SetFinalFlush(func() { flushed.Store(true) })
+	c.OnShutdownComplete(func(_ time.Duration, code int, _ int, _ error) {
+		if code != 1 {
+			t.Errorf("OnShutdownComplete got the code %d, want 1", code)
+		}
+		completed.Store(true)
+	})
+	reason := filepath.Join(t.TempDir(), "reason.json")
+	c.SetExitReasonFile(reason)
+	exited := make(chan int, 2)
+	c.SetExitFunc(func(code int) {
+		if !flushed.Load() || !completed.Load() {
+			t.Error("exited before the final flush and OnShutdownComplete")
+		}
+		if _, err := os.Stat(reason); err != nil {
+			t.Errorf("exited before the exit reason was written: %v", err)
+		}
+		exited <- code
+	})
+	running := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	c.Bind(func() {
+		close(running)
+		<-release
+	})
+	c.SendSignal(syscall.SIGTERM)
+	waitChan(t, running, "cleanup")
+	c.SendSignal(syscall.SIGINT)
+	if code := waitExit(t, exited); code != 1 {
+		t.Errorf("exit code %d, want 1", code)
+	}
+}
+
+func TestChainFailure(t *testing.T) {
+	c, codes := newTestCloser(t, Config{FailCloseOnCleanupError: true})
+	module, _ := newTestCloser(t, Config{})
+	failed := errors.New("flush failed")
+	module.BindErr(func() error { return failed })
+	c.Chain(module)
+	go c.Close()
+	if code := waitExit(t, codes); code != 1 {
+		t.Errorf("exit code %d, want 1 as a chained closer failed", code)
+	}
+	if err := c.Err(); !errors.Is(err, failed) {
+		t.Errorf("Err() = %v, want %v", err, failed)
+	}
+}
+
+func TestZeroConfigErrorCode(t *testing.T) {
+	c, codes := newTestCloser(t, Config{})
+	go c.CloseErr(errors.New("boom"))
+	if code := waitExit(t, codes); code != 1 {
+		t.Errorf("exit code %d, want 1", code)
+	}
+}
+
+// boundCount returns how many cleanups are bound to the closer.
+func boundCount(c *Closer) int {
+	c.sem.Lock()
+	defer c.sem.Unlock()
+	return len(c.cleanups)
+}
+
+func TestBindWithContextUnbindsOnCancel(t *testing.T) {
+	c, codes := newTestCloser(t, Config{})
+	ctx, cancel := context.WithCancel(context.Background())
+	var called atomic.Bool
+	c.BindWithContext(ctx, func() { called.Store(true) })
+	kept := make(chan struct{})
+	c.Bind(func() { close(kept) })
+	cancel()
+	deadline := time.Now().Add(testTimeout)
+	for boundCount(c) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("the cleanup is still bound after its context is done")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	go c.Close()
+	waitExit(t, codes)
+	waitChan(t, kept, "the other cleanup")
+	if called.Load() {
+		t.Error("the cleanup of the done context was called")
+	}
+}
+
+func TestBindWithContextNoLeakAfterStop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	before := runtime.NumGoroutine()
+	c := newCloser(Config{}, false, false)
+	for i := 0; i < 100; i++ {
+		c.BindWithContext(ctx, func() {})
+	}
+	c.Stop()
+	if n := runtime.NumGoroutine() - before; n > 10 {
+		t.Errorf("%d goroutines left after Stop", n)
+	}
+}
+
+func TestShutdownAggregatesErrors(t *testing.T) {
+	c, codes := newTestCloser(t, Config{})
+	errA, errB := errors.New("a failed"), errors.New("b failed")
+	c.BindErr(func() error { return errA })
+	c.Bind(func() { panic("boom") })
+	c.BindErr(func() error { return errB })
+	err := c.Shutdown(context.Background())
+	if !errors.Is(err, errA) || !errors.Is(err, errB) || !strings.Contains(fmt.Sprint(err), "boom") {
+		t.Errorf("error %v, want both errors and the panic", err)
+	}
+	if err := c.Shutdown(context.Background()); !errors.Is(err, ErrAlreadyShutDown) {
+		t.Errorf("second Shutdown %v, want ErrAlreadyShutDown", err)
+	}
+	select {
+	case code := <-codes:
+		t.Errorf("Shutdown exited with %d", code)
+	default:
+	}
+}
+
+func TestShutdownReturnsAsContextIsDone(t *testing.T) {
+	c, _ := newTestCloser(t, Config{})
+	last := make(chan struct{})
+	c.Bind(func() { close(last) })
+	running := make(chan struct{})
+	release := make(chan struct{})
+	c.Bind(func() {
+		close(running)
+		<-release
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	returned := make(chan error, 1)
+	go func() { returned <- c.Shutdown(ctx) }()
+	waitChan(t, running, "cleanup")
+	cancel()
+	if err := <-returned; !errors.Is(err, context.Canceled) {
+		t.Errorf("error %v, want context.Canceled", err)
+	}
+	select {
+	case <-last:
+		t.Fatal("the next cleanup was called before the current one returned")
+	default:
+	}
+	close(release)
+	waitChan(t, last, "the remaining cleanup")
+	waitChan(t, c.Done(), "shutdown")
+}
+
+func TestShutdownAll(t *testing.T) {
+	var order []string
+	newModule := func(name string, err error) *Closer {
+		c := NewCloser(Config{})
+		t.Cleanup(c.Stop)
+		c.BindErr(func() error {
+			order = append(order, name)
+			return err
+		})
+		return c
+	}
+	errB := errors.New("b failed")
+	newModule("a", nil)
+	newModule("b", errB)
+	done := newModule("done", nil)
+	if err := done.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	order = nil
+	err := ShutdownAll(context.Background())
+	if !errors.Is(err, errB) || errors.Is(err, ErrAlreadyShutDown) {
+		t.Errorf("error %v, want the error of b alone", err)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("order %v, want %v", order, want)
+	}
+}
+
+func TestRepanicAfterCleanup(t *testing.T) {
+	c, codes := newTestCloser(t, Config{RepanicAfterCleanup: true})
+	var cleaned atomic.Bool
+	c.Bind(func() { cleaned.Store(true) })
+	repanicked := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			repanicked <- [2]interface{}{recover(), cleaned.Load()}
+		}()
+		defer c.Recover()
+		panic("boom")
+	}()
+	var got interface{}
+	select {
+	case got = <-repanicked:
+	case <-time.After(testTimeout):
+		t.Fatal("no repanic in time")
+	}
+	if want := [2]interface{}{"boom", true}; got != want {
+		t.Errorf("recovered and cleaned %v, want %v", got, want)
+	}
+	select {
+	case code := <-codes:
+		t.Errorf("exited with %d, want the panic to propagate instead", code)
+	default:
+	}
+}
+
+func TestRunSignalCleanups(t *testing.T) {
+	c, codes := newTestCloser(t, Config{ExitSignals: []os.Signal{syscall.SIGTERM, syscall.SIGINT}})
+	var order []string
+	record := func(name string) func() {
+		return func() { order = append(order, name) }
+	}
+	c.BindSignal(syscall.SIGTERM, func() {
+		order = append(order, "term1")
+		panic("term1 failed")
+	})
+	c.BindSignal(syscall.SIGTERM, record("term2"))
+	c.BindSignal(syscall.SIGINT, record("int"))
+	c.Bind(record("plain"))
+	err := c.RunSignalCleanups(syscall.SIGTERM)
+	if err == nil || !strings.Contains(err.Error(), "term1 failed") {
+		t.Errorf("error %v, want the panic of term1", err)
+	}
+	if want := []string{"term2", "term1"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("order %v, want %v", order, want)
+	}
+	select {
+	case code := <-codes:
+		t.Fatalf("exited with %d", code)
+	default:
+	}
+	// unbound, not called again by the shutdown
+	order = nil
+	go c.Close()
+	waitExit(t, codes)
+	if want := []string{"plain"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("shutdown order %v, want %v", order, want)
+	}
+	if err := c.RunSignalCleanups(syscall.SIGINT); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("error after the shutdown %v, want ErrShuttingDown", err)
+	}
+}
+
+func TestBindWorkerPoolDrains(t *testing.T) {
+	c, _ := newTestCloser(t, Config{})
+	jobs := make(chan int, 10)
+	var workers sync.WaitGroup
+	var done atomic.Int32
+	for i := 0; i < 2; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for range jobs {
+				done.Add(1)
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		jobs <- i
+	}
+	c.BindWorkerPool(func() { close(jobs) }, &workers, time.Hour)
+	if err := c.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := done.Load(); n != 10 {
+		t.Errorf("%d jobs done, want 10", n)
+	}
+}
+
+func TestBindWorkerPoolTimeout(t *testing.T) {
+	c, _ := newTestCloser(t, Config{})
+	clk := newFakeClock()
+	c.SetClock(clk)
+	jobs := make(chan int)
+	var workers sync.WaitGroup
+	workers.Add(1)
+	release := make(chan struct{})
+	defer close(release)
+	go func() {
+		defer workers.Done()
+		<-release
+	}()
+	c.BindWorkerPool(func() { close(jobs) }, &workers, time.Minute)
+	returned := make(chan error, 1)
+	go func() { returned <- c.Shutdown(context.Background()) }()
+	waitChan(t, clk.created, "drain timer")
+	clk.Advance(time.Minute)
+	if err := <-returned; err == nil || !strings.Contains(err.Error(), "workers not drained within 1m0s") {
+		t.Errorf("error %v, want the workers not drained", err)
+	}
+}
+
+func TestCriticalSectionDefersSignal(t *testing.T) {
+	c, codes := newTestCloser(t, Config{ExitSignals: []os.Signal{syscall.SIGTERM, syscall.SIGINT}})
+	deferred := make(chan struct{}, 2)
+	c.SetLogFunc(func(level, msg string, kv ...interface{}) {
+		if strings.Contains(msg, "in a critical section, deferred") {
+			deferred <- struct{}{}
+		}
+	})
+	var got []string
+	c.BindSignal(syscall.SIGINT, func() { got = append(got, "int") })
+	c.BindSignal(syscall.SIGTERM, func() { got = append(got, "term") })
+	c.BeginCritical()
+	c.BeginCritical()
+	c.SendSignal(syscall.SIGINT)
+	waitChan(t, deferred, "deferred SIGINT")
+	c.SendSignal(syscall.SIGTERM)
+	waitChan(t, deferred, "deferred SIGTERM")
+	c.EndCritical()
+	select {
+	case code := <-codes:
+		t.Fatalf("exited with %d in the outer critical section", code)
+	case <-time.After(20 * time.Millisecond):
+	}
+	c.EndCritical()
+	waitExit(t, codes)
+	// the first deferred signal is the one delivered
+	if want := []string{"int"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cleanups %v, want %v", got, want)
+	}
+}
+
+func TestMarkCleanShutdown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clean")
+	for _, tc := range []struct {
+		name  string
+		close func(c *Closer)
+		clean bool
+	}{
+		{"close", (*Closer).Close, true},
+		{"signal", func(c *Closer) { c.SendSignal(syscall.SIGTERM) }, true},
+		{"error", func(c *Closer) { c.CloseErr(errors.New("boom")) }, false},
+		{"error code", func(c *Closer) { c.Exit(3) }, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := os.WriteFile(path, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			c, codes := newTestCloser(t, Config{ExitCodeErr: 1, ExitSignals: []os.Signal{syscall.SIGTERM}})
+			if err := c.MarkCleanShutdown(path); err != nil {
+				t.Fatal(err)
+			}
+			if WasCleanShutdown(path) {
+				t.Fatal("the flag is not removed by MarkCleanShutdown")
+			}
+			go tc.close(c)
+			waitExit(t, codes)
+			waitChan(t, c.exitedChan, "exited")
+			if got := WasCleanShutdown(path); got != tc.clean {
+				t.Errorf("clean %v, want %v", got, tc.clean)
+			}
+		})
+	}
+}
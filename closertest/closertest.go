@@ -0,0 +1,140 @@
+// Package closertest provides the helpers to test the shutdown behavior of the apps that embed the closer.
+//
+// A test captures a fresh closer, binds the cleanups to it, triggers the shutdown and asserts the outcome:
+//
+//	r := closertest.Capture(t)
+//	r.Bind("db", db.Close)
+//	r.Bind("server", srv.Close)
+//	r.SendSignal(syscall.SIGTERM)
+//	r.AssertExitCode(0)
+//	r.AssertCleanupOrder("server", "db")
+package closertest
+
+import (
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dpong/closer"
+)
+
+// DefaultTimeout is how long a Recorder waits for the shutdown by default.
+const DefaultTimeout = 5 * time.Second
+
+// Recorder drives a closer that doesn't terminate the test binary and records how it shuts down.
+type Recorder struct {
+	// Closer is the captured closer, the cleanups may be bound to it directly too.
+	Closer *closer.Closer
+	// Timeout is how long the assertions wait for the shutdown to complete.
+	Timeout time.Duration
+
+	t          testing.TB
+	mux        sync.Mutex
+	code       int
+	order      []string
+	exited     chan struct{}
+	exitedOnce sync.Once
+}
+
+// Capture creates a closer with the default exit codes, watching for no OS signals,
+// with the exit function replaced by the recorder. The closer is stopped as the test ends
+// (see Closer.Stop), so it doesn't outlive the test if it hasn't been shut down.
+func Capture(t testing.TB) *Recorder {
+	return CaptureConfig(t, closer.Config{
+		ExitCodeOK:  closer.ExitCodeOK,
+		ExitCodeErr: closer.ExitCodeErr,
+	})
+}
+
+// CaptureConfig is the same as Capture but the closer is configured by cfg.
+func CaptureConfig(t testing.TB, cfg closer.Config) *Recorder {
+	r := &Recorder{
+		Closer:  closer.NewCloser(cfg),
+		Timeout: DefaultTimeout,
+		t:       t,
+		exited:  make(chan struct{}),
+	}
+	r.Closer.SetExitFunc(func(code int) {
+		// the first exit is the one recorded
+		r.exitedOnce.Do(func() {
+			r.mux.Lock()
+			r.code = code
+			r.mux.Unlock()
+			close(r.exited)
+		})
+	})
+	t.Cleanup(r.Closer.Stop)
+	return r
+}
+
+// Bind binds the named cleanup to the closer, recording when it gets called.
+func (r *Recorder) Bind(name string, fn func()) *closer.Handle {
+	return r.Closer.BindNamed(name, func() {
+		r.mux.Lock()
+		r.order = append(r.order, name)
+		r.mux.Unlock()
+		fn()
+	})
+}
+
+// SendSignal delivers the signal to the closer as if it was received from the OS.
+func (r *Recorder) SendSignal(sig os.Signal) {
+	r.t.Helper()
+	r.Closer.SendSignal(sig)
+}
+
+// Wait waits for the closer to exit, failing the test if it doesn't within the Timeout.
+func (r *Recorder) Wait() {
+	r.t.Helper()
+	select {
+	case <-r.exited:
+	case <-time.After(r.Timeout):
+		r.t.Fatalf("closertest: no exit within %v", r.Timeout)
+	}
+}
+
+// AssertExitCode waits for the closer to exit and checks the exit code.
+func (r *Recorder) AssertExitCode(code int) {
+	r.t.Helper()
+	r.Wait()
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.code != code {
+		r.t.Errorf("closertest: exit code %d, want %d", r.code, code)
+	}
+}
+
+// AssertCleanupOrder waits for the shutdown to complete and checks the cleanups bound via Bind
+// have been called exactly in the given order.
+func (r *Recorder) AssertCleanupOrder(names ...string) {
+	r.t.Helper()
+	select {
+	case <-r.Closer.Done():
+	case <-time.After(r.Timeout):
+		r.t.Fatalf("closertest: no shutdown within %v", r.Timeout)
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if !reflect.DeepEqual(r.order, names) && !(len(r.order) == 0 && len(names) == 0) {
+		r.t.Errorf("closertest: cleanup order %q, want %q", r.order, names)
+	}
+}
+
+// GuardExit keeps the default closer from terminating the test binary: until the test ends
+// its exit fails the test with the exit code instead of calling os.Exit, and the shutdown
+// goroutine returns as if the exit function was replaced by SetExitFunc.
+func GuardExit(t testing.TB) {
+	closer.SetExitFunc(func(code int) {
+		t.Errorf("closertest: the default closer exited with code %d", code)
+	})
+	t.Cleanup(func() {
+		select {
+		case <-closer.ShutdownStarted():
+			// the exit has been taken already, the hooks are locked
+		default:
+			closer.SetExitFunc(os.Exit)
+		}
+	})
+}
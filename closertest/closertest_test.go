@@ -0,0 +1,70 @@
+package closertest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/dpong/closer"
+)
+
+func TestCaptureSignal(t *testing.T) {
+	r := Capture(t)
+	r.Bind("db", func() {})
+	r.Bind("server", func() {})
+	r.SendSignal(syscall.SIGTERM)
+	r.AssertExitCode(closer.ExitCodeOK)
+	r.AssertCleanupOrder("server", "db")
+}
+
+func TestCaptureCloseErr(t *testing.T) {
+	r := CaptureConfig(t, closer.Config{ExitCodeErr: 3})
+	r.Bind("db", func() {})
+	go r.Closer.CloseErr(errors.New("boom"))
+	r.AssertExitCode(3)
+	r.AssertCleanupOrder("db")
+}
+
+func TestCaptureStoppedAfterTest(t *testing.T) {
+	var called bool
+	t.Run("unused", func(t *testing.T) {
+		r := Capture(t)
+		r.Bind("late", func() { called = true })
+	})
+	if err := closer.ShutdownAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if called {
+		t.Error("the closer of a finished test has been shut down")
+	}
+}
+
+// recordingTB records the errors and the cleanups instead of failing the test.
+type recordingTB struct {
+	testing.TB
+	errs     []string
+	cleanups []func()
+}
+
+func (tb *recordingTB) Errorf(format string, args ...interface{}) {
+	tb.errs = append(tb.errs, fmt.Sprintf(format, args...))
+}
+
+func (tb *recordingTB) Cleanup(fn func()) {
+	tb.cleanups = append(tb.cleanups, fn)
+}
+
+func TestGuardExit(t *testing.T) {
+	tb := &recordingTB{TB: t}
+	GuardExit(tb)
+	closer.Exit(3)
+	if len(tb.errs) != 1 || !strings.Contains(tb.errs[0], "code 3") {
+		t.Errorf("errors %q, want the exit reported", tb.errs)
+	}
+	for _, fn := range tb.cleanups {
+		fn()
+	}
+}
@@ -0,0 +1,77 @@
+package closer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"runtime"
+	"sync"
+)
+
+// DumpStack writes the stacktrace of the calling goroutine to w (the stack writer if nil) the same way
+// the stacktrace of a recovered panic is printed, as per StackFormat and MaxPrintedFrames, e.g. to see
+// how a live process has got somewhere.
+func DumpStack(w io.Writer) {
+	std().dumpStack(w, 2)
+}
+
+// DumpStack is the same as the package-level DumpStack but for this closer.
+func (c *Closer) DumpStack(w io.Writer) {
+	c.dumpStack(w, 2)
+}
+
+func (c *Closer) dumpStack(w io.Writer, offset int) {
+	if w == nil {
+		w = c.stackWriter()
+	}
+	c.writeStack(w, panicStack(offset))
+}
+
+// writeStack writes the frames as per StackFormat, no more than MaxPrintedFrames.
+func (c *Closer) writeStack(w io.Writer, stack []StackFrame) {
+	printed := stack
+	if c.maxFrames > 0 && len(printed) > c.maxFrames {
+		printed = printed[:c.maxFrames]
+	}
+	for _, frame := range printed {
+		fmt.Fprint(w, frame.FormatAs(c.stackFormat))
+	}
+	if n := len(stack) - len(printed); n > 0 {
+		fmt.Fprintf(w, "... %d more frames\n", n)
+	}
+}
+
+// DumpStacksOn makes the signal (e.g. SIGUSR1, it's opt-in) write the stacktraces of all the goroutines
+// to the stack writer, up to GoroutineDumpSize, to debug a live process. Note that the goroutine that
+// receives the signal has nothing to tell, hence all of them rather than DumpStack. The signal must not
+// be watched for, see ExitSignals and ReloadSignals. Calling stop stops the dumping.
+func DumpStacksOn(sig os.Signal) (stop func()) {
+	return std().DumpStacksOn(sig)
+}
+
+// DumpStacksOn is the same as the package-level DumpStacksOn but for this closer.
+func (c *Closer) DumpStacksOn(sig os.Signal) (stop func()) {
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigs, sig)
+	go func() {
+		for {
+			select {
+			case <-sigs:
+				buf := make([]byte, c.dumpSize)
+				buf = buf[:runtime.Stack(buf, true)]
+				c.stackWriter().Write(buf)
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(sigs)
+			close(done)
+		})
+	}
+}
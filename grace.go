@@ -0,0 +1,54 @@
+package closer
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GracePeriodFromEnv sets the ShutdownTimeout from the grace period the orchestrator gives the app before
+// killing it, as injected into the env var (e.g. TERMINATION_GRACE_PERIOD), minus the margin, so the app
+// exits on its own just before the hard kill. The value is either a number of seconds ("30") or a duration
+// ("1m30s"). If the margin doesn't leave anything, half the grace period is used. An unset or empty var
+// leaves the timeout as is, an invalid one is logged as a warning. It returns the resulting ShutdownTimeout,
+// the resolved one is logged.
+func GracePeriodFromEnv(name string, margin time.Duration) time.Duration {
+	return std().GracePeriodFromEnv(name, margin)
+}
+
+// GracePeriodFromEnv is the same as the package-level GracePeriodFromEnv but for this closer.
+func (c *Closer) GracePeriodFromEnv(name string, margin time.Duration) time.Duration {
+	c.sem.Lock()
+	defer c.sem.Unlock()
+	value := strings.TrimSpace(os.Getenv(name))
+	if len(value) == 0 {
+		return c.timeout
+	}
+	grace, err := parseGracePeriod(value)
+	if err != nil {
+		c.log(LevelWarn, "grace_error", "invalid grace period in "+name+": "+value, "env", name, "error", err)
+		return c.timeout
+	}
+	timeout := grace - margin
+	if timeout <= 0 {
+		timeout = grace / 2
+	}
+	c.timeout = timeout
+	c.log(LevelWarn, "grace_period", "shutdown timeout set to "+timeout.String()+" from "+name,
+		"env", name, "grace", grace, "timeout", timeout)
+	return timeout
+}
+
+// parseGracePeriod parses the bare seconds or a duration, it must be positive.
+func parseGracePeriod(value string) (time.Duration, error) {
+	grace, err := time.ParseDuration(value)
+	if secs, atoiErr := strconv.Atoi(value); atoiErr == nil {
+		grace, err = time.Duration(secs)*time.Second, nil
+	}
+	if err == nil && grace <= 0 {
+		err = errors.New("not a positive duration")
+	}
+	return grace, err
+}
@@ -0,0 +1,44 @@
+package closer
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGracePeriodFromEnv(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		want  time.Duration
+	}{
+		{"30", 25 * time.Second},
+		{"1m30s", 85 * time.Second},
+		{"4", 2 * time.Second},
+		{"", time.Minute},
+		{"soon", time.Minute},
+	} {
+		t.Run(tc.value, func(t *testing.T) {
+			t.Setenv("GRACE", tc.value)
+			c, _ := newTestCloser(t, Config{ShutdownTimeout: time.Minute})
+			if got := c.GracePeriodFromEnv("GRACE", 5*time.Second); got != tc.want {
+				t.Errorf("timeout %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGracePeriodLoggedByDefault(t *testing.T) {
+	t.Setenv("GRACE", "30")
+	c, _ := newTestCloser(t, Config{})
+	var buf bytes.Buffer
+	out := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(out)
+	c.GracePeriodFromEnv("GRACE", 5*time.Second)
+	log.SetOutput(out)
+	if !strings.Contains(buf.String(), "shutdown timeout set to 25s from GRACE") {
+		t.Errorf("grace period not logged, the output is %q", buf.String())
+	}
+}
@@ -0,0 +1,63 @@
+package closer
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultHealthInterval is the interval WatchHealth checks the health at if the one given isn't positive.
+const DefaultHealthInterval = time.Second
+
+// WatchHealth runs the health check of a critical dependency (e.g. a disk or a database) every interval and
+// requests the close with an error, like CloseErr does, once it has failed failThreshold times in a row,
+// so the orchestrator replaces the app. A panic in the check counts as a failure, each failure is logged
+// as a warning. The watching stops as the shutdown starts. A threshold below 1 means 1, an interval
+// that isn't positive means DefaultHealthInterval.
+func WatchHealth(check func() error, interval time.Duration, failThreshold int) {
+	std().WatchHealth(check, interval, failThreshold)
+}
+
+// WatchHealth is the same as the package-level WatchHealth but for this closer.
+func (c *Closer) WatchHealth(check func() error, interval time.Duration, failThreshold int) {
+	if failThreshold < 1 {
+		failThreshold = 1
+	}
+	if interval <= 0 {
+		// not to spin on the check
+		interval = DefaultHealthInterval
+	}
+	go func() {
+		failures := 0
+		for {
+			t := c.clock.NewTimer(interval)
+			select {
+			case <-c.ctx.Done():
+				t.Stop()
+				return
+			case <-t.C():
+			}
+			err := checkHealth(check)
+			if err == nil {
+				failures = 0
+				continue
+			}
+			failures++
+			c.log(LevelWarn, "health_failure", fmt.Sprintf("health check failed (%d of %d): %v", failures, failThreshold, err),
+				"failures", failures, "threshold", failThreshold, "error", err)
+			if failures >= failThreshold {
+				c.closeErr(fmt.Errorf("closer: health check failed %d times in a row: %w", failures, err))
+				return
+			}
+		}
+	}()
+}
+
+// checkHealth calls the check, a panic is recovered and returned as an error.
+func checkHealth(check func() error) (err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			err = fmt.Errorf("health check panic: %v", x)
+		}
+	}()
+	return check()
+}
@@ -0,0 +1,67 @@
+package closer
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchHealthFailures(t *testing.T) {
+	c, codes := newTestCloser(t, Config{ExitCodeErr: 1})
+	clk := newFakeClock()
+	c.SetClock(clk)
+	// a success in between resets the count
+	results := []error{errors.New("down"), errors.New("down"), nil, errors.New("down"), errors.New("down"), errors.New("down")}
+	var checks atomic.Int32
+	c.WatchHealth(func() error {
+		return results[checks.Add(1)-1]
+	}, time.Second, 3)
+	for range results {
+		waitChan(t, clk.created, "health timer")
+		clk.Advance(time.Second)
+	}
+	if code := waitExit(t, codes); code != 1 {
+		t.Errorf("exit code %d, want 1", code)
+	}
+	if n := checks.Load(); int(n) != len(results) {
+		t.Errorf("%d checks, want %d", n, len(results))
+	}
+	if err := c.Err(); err == nil || !strings.Contains(err.Error(), "3 times in a row") {
+		t.Errorf("Err() = %v, want the health failure", err)
+	}
+}
+
+func TestWatchHealthPanic(t *testing.T) {
+	c, codes := newTestCloser(t, Config{ExitCodeErr: 1})
+	clk := newFakeClock()
+	c.SetClock(clk)
+	c.WatchHealth(func() error { panic("broken") }, time.Second, 0)
+	waitChan(t, clk.created, "health timer")
+	clk.Advance(time.Second)
+	if code := waitExit(t, codes); code != 1 {
+		t.Errorf("exit code %d, want 1", code)
+	}
+}
+
+func TestWatchHealthZeroInterval(t *testing.T) {
+	c, codes := newTestCloser(t, Config{ExitCodeErr: 1})
+	clk := newFakeClock()
+	c.SetClock(clk)
+	var checks atomic.Int32
+	c.WatchHealth(func() error {
+		checks.Add(1)
+		return errors.New("down")
+	}, 0, 1)
+	waitChan(t, clk.created, "health timer")
+	clk.Advance(DefaultHealthInterval - time.Nanosecond)
+	time.Sleep(20 * time.Millisecond)
+	if n := checks.Load(); n != 0 {
+		t.Fatalf("%d checks before the default interval", n)
+	}
+	clk.Advance(time.Nanosecond)
+	if code := waitExit(t, codes); code != 1 {
+		t.Errorf("exit code %d, want 1", code)
+	}
+}
@@ -0,0 +1,168 @@
+package closer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Log levels passed to the function set via SetLogFunc.
+const (
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+// OutputFormat defines how the package writes its diagnostics when no log function is set.
+type OutputFormat int
+
+const (
+	// FormatText writes the plain messages with the standard `log` package and the panic stacktraces
+	// to the stack writer. The messages of LevelInfo are omitted. That's the default.
+	FormatText OutputFormat = iota
+	// FormatJSON writes every message (of any level) to the output of the standard `log` package
+	// as a single JSON object per line, the panic stacktraces included. See SetOutputFormat for the schema.
+	FormatJSON
+)
+
+// SetLogFunc sets the function the package will emit its log messages with, so any logging library
+// can be plugged in. The level is one of LevelInfo, LevelWarn or LevelError, msg is a complete human-readable
+// message and kv holds the key/value pairs describing the event, the first pair is always ("event", <event>).
+// By default the messages are written as defined by SetOutputFormat, that's what a nil fn restores.
+//
+// The emitted messages (the message texts are not meant to be parsed) are:
+//
+//	Level | Event            | When                                                 | Keys
+//	----- | ---------------- | ---------------------------------------------------- | ---------------------------------
+//	info  | shutdown         | the shutdown has started                             | cause, signal
+//	info  | complete         | the shutdown has completed                           | cause, code, duration, ran, error
+//	info  | cleanup_skipped  | a disabled callback was skipped                      | callback, label
+//	info  | ready            | Ready was called                                     | duration
+//	info  | hold             | Hold was called                                      | ready
+//	info  | signal_ignored   | a signal received while the cleanups ran was ignored | signal
+//	info  | watching         | the closer starts watching for the signals           | signals
+//	info  | parent_death     | the close on the parent death has been set up        | signal, ppid
+//	error | panic            | a panic was recovered                                | panic, stack
+//	error | error            | Checked's target returned an error                   | error
+//	error | cleanup_error    | a callback panicked or failed                        | callback, label, error
+//	error | timeout          | the ShutdownTimeout elapsed                          | timeout, stuck, label, skipped
+//	error | cleanups_lost    | none of the cleanups due has been called             | due
+//	warn  | cleanup_cycle    | the BindAfter dependencies form a cycle              | callbacks
+//	warn  | pidfile_error    | the pid file could not be removed                    | path, error
+//	warn  | unwatched_signal | callbacks are bound to a signal not watched for      | signal
+//	warn  | late_bind        | a callback was bound after the shutdown started      | callback
+//	warn  | main_thread      | no Hold to call the main thread callbacks            |
+//	warn  | cleanup_signal   | a signal was received while the cleanups ran         | signal, policy
+//	warn  | progress         | the cleanups are running, see ProgressInterval       | done, total, current
+//	warn  | reason_error     | the exit reason file could not be written            | path, error
+//	warn  | signal_deferred  | a signal was received in a critical section          | signal
+//	warn  | sigpipe_watched  | SIGPIPE is one of the watched signals                |
+//	warn  | grace_error      | the grace period env var is invalid                  | env, error
+//	warn  | parent_error     | the close on the parent death cannot be set up       | error
+//	warn  | clean_flag_error | the clean shutdown flag could not be written         | path, error
+//	warn  | health_failure   | the health check set via WatchHealth failed          | failures, threshold, error
+//	warn  | late_hook        | a hook was set after the shutdown started            | hook
+//	warn  | signal_observed  | a signal is received in the observe-only mode        | signal, ts
+//	warn  | grace_period     | the ShutdownTimeout is set from the env              | env, grace, timeout
+//
+// The signal key is omitted unless the cause is CauseSignal, the error key of the complete event
+// is omitted if there was no error. The stack is a []StackFrame.
+func SetLogFunc(fn func(level, msg string, kv ...interface{})) {
+	std().SetLogFunc(fn)
+}
+
+// SetLogFunc is the same as the package-level SetLogFunc but for this closer.
+func (c *Closer) SetLogFunc(fn func(level, msg string, kv ...interface{})) {
+	c.mux.Lock()
+	c.logFunc = fn
+	c.logCtxFunc = nil
+	c.mux.Unlock()
+}
+
+// SetLogFuncContext is the same as SetLogFunc, but the function also gets the context of the closer
+// (see Context), so it can be passed along to a context-aware logger, e.g. slog's InfoContext.
+// It replaces the function set via SetLogFunc and vice versa.
+func SetLogFuncContext(fn func(ctx context.Context, level, msg string, kv ...interface{})) {
+	std().SetLogFuncContext(fn)
+}
+
+// SetLogFuncContext is the same as the package-level SetLogFuncContext but for this closer.
+func (c *Closer) SetLogFuncContext(fn func(ctx context.Context, level, msg string, kv ...interface{})) {
+	c.mux.Lock()
+	c.logCtxFunc = fn
+	c.logFunc = nil
+	c.mux.Unlock()
+}
+
+// SetOutputFormat sets how the package writes its diagnostics if no log function is set via SetLogFunc.
+//
+// With FormatJSON every line is an object with the fields: ts (RFC 3339 timestamp), level, event, msg
+// and the keys of the event as listed by SetLogFunc. The values implementing error or fmt.Stringer
+// (signals, causes, durations) are written as strings, the stack is an array of objects with the fields
+// of StackFrame. For example:
+//
+//	{"cause":"signal","event":"shutdown","level":"info","msg":"shutdown started","signal":"SIGTERM","ts":"..."}
+func SetOutputFormat(format OutputFormat) {
+	std().SetOutputFormat(format)
+}
+
+// SetOutputFormat is the same as the package-level SetOutputFormat but for this closer.
+func (c *Closer) SetOutputFormat(format OutputFormat) {
+	c.mux.Lock()
+	c.format = format
+	c.mux.Unlock()
+}
+
+func (c *Closer) outputFormat() OutputFormat {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.format
+}
+
+func (c *Closer) log(level, event, msg string, kv ...interface{}) {
+	c.mux.Lock()
+	fn := c.logFunc
+	ctxFn := c.logCtxFunc
+	format := c.format
+	c.mux.Unlock()
+	switch {
+	case ctxFn != nil:
+		ctxFn(c.ctx, level, msg, append([]interface{}{"event", event}, kv...)...)
+	case fn != nil:
+		fn(level, msg, append([]interface{}{"event", event}, kv...)...)
+	case format == FormatJSON:
+		writeJSON(c.clock.Now(), level, event, msg, kv)
+	case level != LevelInfo:
+		log.Print(msg)
+	}
+}
+
+func writeJSON(now time.Time, level, event, msg string, kv []interface{}) {
+	obj := map[string]interface{}{
+		"ts":    now.Format(time.RFC3339Nano),
+		"level": level,
+		"event": event,
+		"msg":   msg,
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		key := fmt.Sprint(kv[i])
+		switch v := kv[i+1].(type) {
+		case error:
+			obj[key] = v.Error()
+		case fmt.Stringer:
+			obj[key] = v.String()
+		default:
+			obj[key] = v
+		}
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		// some value can't be marshalled, the message is still worth writing
+		data, _ = json.Marshal(map[string]interface{}{
+			"ts": obj["ts"], "level": level, "event": event, "msg": msg,
+		})
+	}
+	log.Writer().Write(append(data, '\n'))
+}
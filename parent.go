@@ -0,0 +1,42 @@
+package closer
+
+import (
+	"os"
+	"syscall"
+)
+
+// CloseOnParentDeath makes the process shut down once its parent dies, so the children of a process tree
+// don't get orphaned. On Linux the parent death signal (PR_SET_PDEATHSIG) is set to SIGTERM if it's watched for,
+// to the first watched signal otherwise; if the parent dies meanwhile, the close is requested right away.
+// Note that the death of the parent thread (not the process) counts, so the parent written in Go should
+// start the child from a goroutine locked to its OS thread for good. Nothing can be done if no signal is
+// watched for, or on the other platforms, that's logged as a warning.
+func CloseOnParentDeath() {
+	std().CloseOnParentDeath()
+}
+
+// CloseOnParentDeath is the same as the package-level CloseOnParentDeath but for this closer.
+func (c *Closer) CloseOnParentDeath() {
+	c.sem.Lock()
+	var sig syscall.Signal
+	for _, watched := range c.signals {
+		if s, ok := watched.(syscall.Signal); ok && (sig == 0 || s == syscall.SIGTERM) {
+			sig = s
+		}
+	}
+	c.sem.Unlock()
+	if sig == 0 {
+		c.log(LevelWarn, "parent_error", "no signal watched for to be sent on the parent death")
+		return
+	}
+	ppid := os.Getppid()
+	if err := setParentDeathSignal(sig); err != nil {
+		c.log(LevelWarn, "parent_error", "cannot close on the parent death: "+err.Error(), "error", err)
+		return
+	}
+	c.log(LevelInfo, "parent_death", "closing on the parent death", "signal", SignalName(sig), "ppid", ppid)
+	if os.Getppid() != ppid {
+		// reparented before the signal has been set
+		go c.close(nil)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build linux
+
+package closer
+
+import "syscall"
+
+// setParentDeathSignal sets the signal the process gets as its parent dies.
+func setParentDeathSignal(sig syscall.Signal) error {
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_SET_PDEATHSIG, uintptr(sig), 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package closer
+
+import (
+	"errors"
+	"syscall"
+)
+
+// setParentDeathSignal is not supported but on Linux.
+func setParentDeathSignal(sig syscall.Signal) error {
+	return errors.New("not supported on this platform")
+}
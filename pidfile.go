@@ -0,0 +1,64 @@
+package closer
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// WritePIDFile writes the pid of the process to the file at path. The file will be removed at the very end
+// of the shutdown, right before os.Exit, so the external tooling may poll for its disappearance to know
+// the graceful shutdown has completed. A failure to remove the file is logged and doesn't block the exit.
+func WritePIDFile(path string) error {
+	return std().WritePIDFile(path)
+}
+
+// WritePIDFile is the same as the package-level WritePIDFile but for this closer.
+func (c *Closer) WritePIDFile(path string) error {
+	pid := strconv.Itoa(os.Getpid()) + "\n"
+	if err := writeFile(path, []byte(pid), 0644); err != nil {
+		return err
+	}
+	c.mux.Lock()
+	c.pidFile = path
+	c.mux.Unlock()
+	return nil
+}
+
+func (c *Closer) removePIDFile() {
+	c.mux.Lock()
+	path := c.pidFile
+	c.mux.Unlock()
+	if len(path) == 0 {
+		return
+	}
+	if err := removeFile(path); err != nil {
+		c.log(LevelWarn, "pidfile_error", "failed to remove the pid file: "+err.Error(), "path", path, "error", err)
+	}
+}
+
+// maxEINTR is how many times the file operations of the shutdown are retried if interrupted by a signal.
+const maxEINTR = 8
+
+// writeFile is os.WriteFile retried on EINTR: the signals keep coming during the shutdown, and although
+// the Go runtime retries most of the interrupted syscalls, a filesystem (e.g. a FUSE or a network one)
+// may still report it.
+func writeFile(path string, data []byte, perm os.FileMode) (err error) {
+	for i := 0; i < maxEINTR; i++ {
+		if err = os.WriteFile(path, data, perm); !errors.Is(err, syscall.EINTR) {
+			return err
+		}
+	}
+	return err
+}
+
+// removeFile is os.Remove retried on EINTR, see writeFile.
+func removeFile(path string) (err error) {
+	for i := 0; i < maxEINTR; i++ {
+		if err = os.Remove(path); !errors.Is(err, syscall.EINTR) {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,50 @@
+package closer
+
+import "context"
+
+// Ready marks the app as fully up, that is all the startup is done, which unblocks WaitReady,
+// e.g. for a readiness probe. The time it took since the closer was created is logged.
+// The further calls do nothing. Ready is optional and doesn't affect the shutdown.
+func Ready() {
+	std().Ready()
+}
+
+// Ready is the same as the package-level Ready but for this closer.
+func (c *Closer) Ready() {
+	c.readyOnce.Do(func() {
+		close(c.readyChan)
+		c.log(LevelInfo, "ready", "app is ready", "duration", c.clock.Now().Sub(c.created))
+	})
+}
+
+// WaitReady blocks until Ready is called, it returns nil then. It returns ErrShuttingDown
+// if the shutdown starts before, or the ctx error if ctx is done before.
+func WaitReady(ctx context.Context) error {
+	return std().WaitReady(ctx)
+}
+
+// WaitReady is the same as the package-level WaitReady but for this closer.
+func (c *Closer) WaitReady(ctx context.Context) error {
+	// Ready wins over the shutdown that has started after it
+	if c.isReady() {
+		return nil
+	}
+	select {
+	case <-c.readyChan:
+		return nil
+	case <-c.startedChan:
+		return ErrShuttingDown
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// isReady tells if Ready has been called.
+func (c *Closer) isReady() bool {
+	select {
+	case <-c.readyChan:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,52 @@
+package closer
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// SetExitReasonFile sets the file the reason of the exit is written to at the very end of the shutdown, along
+// with the pid file removal, for the post-mortem debugging. It's a JSON object with the ts, cause, code, signal
+// and error keys (the last two are omitted if empty). A failure to write the file is logged and doesn't block
+// the exit. Empty path means no file, that's the default.
+func SetExitReasonFile(path string) {
+	std().SetExitReasonFile(path)
+}
+
+// SetExitReasonFile is the same as the package-level SetExitReasonFile but for this closer.
+func (c *Closer) SetExitReasonFile(path string) {
+	c.mux.Lock()
+	c.reasonFile = path
+	c.mux.Unlock()
+}
+
+func (c *Closer) writeExitReason(cause ShutdownCause, sig os.Signal, code int, err error) {
+	c.mux.Lock()
+	path := c.reasonFile
+	c.mux.Unlock()
+	if len(path) == 0 {
+		return
+	}
+	reason := struct {
+		TS     string `json:"ts"`
+		Cause  string `json:"cause"`
+		Code   int    `json:"code"`
+		Signal string `json:"signal,omitempty"`
+		Error  string `json:"error,omitempty"`
+	}{
+		TS:    c.clock.Now().Format(time.RFC3339Nano),
+		Cause: cause.String(),
+		Code:  code,
+	}
+	if sig != nil {
+		reason.Signal = SignalName(sig)
+	}
+	if err != nil {
+		reason.Error = err.Error()
+	}
+	data, _ := json.Marshal(reason)
+	if err := writeFile(path, append(data, '\n'), 0644); err != nil {
+		c.log(LevelWarn, "reason_error", "failed to write the exit reason file: "+err.Error(), "path", path, "error", err)
+	}
+}
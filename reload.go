@@ -0,0 +1,48 @@
+package closer
+
+// BindReload will register the callback that will be called on every reload, see Reload.
+// The reload callbacks are called in the order they were bound.
+func BindReload(fn func()) {
+	std().BindReload(fn)
+}
+
+// BindReload is the same as the package-level BindReload but for this closer.
+func (c *Closer) BindReload(fn func()) {
+	c.reloadMux.Lock()
+	c.onReload = append(c.onReload, fn)
+	c.reloadMux.Unlock()
+}
+
+// Reload calls the reload callbacks, e.g. on a request to an admin endpoint. It neither exits
+// nor needs a signal. The reloads don't overlap, and once the shutdown has started (see IsClosing)
+// Reload does nothing, while the shutdown waits for a reload in progress to complete.
+//
+// A reload callback may request the close (e.g. Fatalf on an invalid config), the request returns right
+// away then and the shutdown starts as the reload completes.
+func Reload() {
+	std().Reload()
+}
+
+// Reload is the same as the package-level Reload but for this closer.
+func (c *Closer) Reload() {
+	// a reload callback requesting the close must not wait for the shutdown, as it waits for the reload
+	defer c.enterCallbacks()()
+	c.reloadMux.Lock()
+	defer c.reloadMux.Unlock()
+	if c.IsClosing() {
+		return
+	}
+	for _, fn := range c.onReload {
+		c.callHook("BindReload", fn)
+	}
+}
+
+// IsClosing tells if the shutdown has started.
+func IsClosing() bool {
+	return std().IsClosing()
+}
+
+// IsClosing is the same as the package-level IsClosing but for this closer.
+func (c *Closer) IsClosing() bool {
+	return c.started.Load()
+}
@@ -0,0 +1,63 @@
+package closer
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShutdownWaitsForReload(t *testing.T) {
+	c, codes := newTestCloser(t, Config{})
+	reloading := make(chan struct{})
+	release := make(chan struct{})
+	var reloaded, cleanedAfter atomic.Bool
+	c.BindReload(func() {
+		close(reloading)
+		<-release
+		reloaded.Store(true)
+	})
+	c.Bind(func() { cleanedAfter.Store(reloaded.Load()) })
+	go c.Reload()
+	waitChan(t, reloading, "reload")
+	go c.Close()
+	select {
+	case code := <-codes:
+		t.Fatalf("exited with %d during the reload", code)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	waitExit(t, codes)
+	if !cleanedAfter.Load() {
+		t.Error("the cleanup ran before the reload completed")
+	}
+}
+
+func TestReloadAfterShutdown(t *testing.T) {
+	c, codes := newTestCloser(t, Config{})
+	c.BindReload(func() { t.Error("reloaded after the shutdown has started") })
+	go c.Close()
+	waitExit(t, codes)
+	c.Reload()
+}
+
+func TestConcurrentReloadAndClose(t *testing.T) {
+	c, codes := newTestCloser(t, Config{})
+	var reloads atomic.Int32
+	c.BindReload(func() { reloads.Add(1) })
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for !c.IsClosing() {
+			c.Reload()
+		}
+		c.Reload()
+	}()
+	go c.Close()
+	waitExit(t, codes)
+	waitChan(t, done, "reloads")
+	n := reloads.Load()
+	c.Reload()
+	if reloads.Load() != n {
+		t.Error("reloaded after the shutdown")
+	}
+}
@@ -0,0 +1,51 @@
+package closer
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// signalNames holds the canonical names of the signals available on every platform,
+// the platform-specific ones get added by the init functions.
+var signalNames = map[os.Signal]string{
+	syscall.SIGABRT: "SIGABRT",
+	syscall.SIGALRM: "SIGALRM",
+	syscall.SIGBUS:  "SIGBUS",
+	syscall.SIGFPE:  "SIGFPE",
+	syscall.SIGHUP:  "SIGHUP",
+	syscall.SIGILL:  "SIGILL",
+	syscall.SIGINT:  "SIGINT",
+	syscall.SIGKILL: "SIGKILL",
+	syscall.SIGPIPE: "SIGPIPE",
+	syscall.SIGQUIT: "SIGQUIT",
+	syscall.SIGSEGV: "SIGSEGV",
+	syscall.SIGTERM: "SIGTERM",
+	syscall.SIGTRAP: "SIGTRAP",
+}
+
+// IgnoreSIGPIPE makes the process ignore SIGPIPE, so neither the writes to the closed sockets or pipes
+// nor a SIGPIPE sent by another process terminate it, a write fails with syscall.EPIPE instead. That's
+// usually what a network server wants. It's a no-op on the platforms without SIGPIPE.
+func IgnoreSIGPIPE() {
+	if sigPIPE != nil {
+		signal.Ignore(sigPIPE)
+	}
+}
+
+// signalNumber returns the number of the signal, if it's a syscall.Signal.
+func signalNumber(sig os.Signal) (int, bool) {
+	if s, ok := sig.(syscall.Signal); ok {
+		return int(s), true
+	}
+	return 0, false
+}
+
+// SignalName returns the canonical name of the signal, e.g. "SIGTERM", the same on every platform.
+// For an unknown signal it falls back to sig.String().
+func SignalName(sig os.Signal) string {
+	if name, ok := signalNames[sig]; ok {
+		return name
+	}
+	return sig.String()
+}
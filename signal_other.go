@@ -0,0 +1,8 @@
+//go:build !unix
+
+package closer
+
+import "os"
+
+// sigPIPE is nil, SIGPIPE is never raised on these platforms.
+var sigPIPE os.Signal
@@ -0,0 +1,152 @@
+package closer
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestDefaultSignalSet(t *testing.T) {
+	debug := []os.Signal{syscall.SIGINT, syscall.SIGHUP, syscall.SIGTERM}
+	if !reflect.DeepEqual(DebugSignalSet, debug) {
+		t.Errorf("DebugSignalSet = %v, want %v", DebugSignalSet, debug)
+	}
+	if want := append(debug, syscall.SIGABRT); !reflect.DeepEqual(DefaultSignalSet, want) {
+		t.Errorf("DefaultSignalSet = %v, want %v", DefaultSignalSet, want)
+	}
+	if &DefaultSignalSet[0] == &DebugSignalSet[0] {
+		t.Error("DefaultSignalSet shares the array of DebugSignalSet")
+	}
+}
+
+func TestSignalLoggedByName(t *testing.T) {
+	c, codes := newTestCloser(t, Config{})
+	var mux sync.Mutex
+	logged := map[string]interface{}{}
+	c.SetLogFunc(func(level, msg string, kv ...interface{}) {
+		var event string
+		var sig interface{}
+		for i := 0; i+1 < len(kv); i += 2 {
+			switch kv[i] {
+			case "event":
+				event, _ = kv[i+1].(string)
+			case "signal":
+				sig = kv[i+1]
+			}
+		}
+		if sig != nil {
+			mux.Lock()
+			logged[event] = sig
+			mux.Unlock()
+		}
+	})
+	running := make(chan struct{})
+	release := make(chan struct{})
+	c.Bind(func() {
+		close(running)
+		<-release
+	})
+	c.SendSignal(syscall.SIGTERM)
+	waitChan(t, running, "cleanup")
+	c.SendSignal(syscall.SIGINT)
+	waitForIgnored(t, c, syscall.SIGINT)
+	close(release)
+	waitExit(t, codes)
+	mux.Lock()
+	defer mux.Unlock()
+	for event, want := range map[string]string{"shutdown": "SIGTERM", "signal_ignored": "SIGINT"} {
+		if logged[event] != want {
+			t.Errorf("%s logged signal %#v, want %q", event, logged[event], want)
+		}
+	}
+}
+
+// waitForIgnored waits until the closer has counted the signal as ignored.
+func waitForIgnored(t *testing.T, c *Closer, sig os.Signal) {
+	t.Helper()
+	for i := 0; c.IgnoredSignalCounts()[sig] == 0; i++ {
+		if i == 1000 {
+			t.Fatalf("%v not ignored in time", sig)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestObserveOnlyCountsIgnored(t *testing.T) {
+	c, codes := newTestCloser(t, Config{})
+	c.SetObserveOnly(true)
+	c.SendSignal(syscall.SIGTERM)
+	waitForIgnored(t, c, syscall.SIGTERM)
+	if n := c.SignalCounts()[syscall.SIGTERM]; n != 0 {
+		t.Errorf("observed SIGTERM counted %d times as acted upon", n)
+	}
+	if c.IsClosing() {
+		t.Error("observed SIGTERM started the shutdown")
+	}
+	go c.Close()
+	waitExit(t, codes)
+}
+
+func TestSignalRules(t *testing.T) {
+	for _, tc := range []struct {
+		sig  os.Signal
+		code int
+		ran  string
+	}{
+		{syscall.SIGTERM, 0, "flush"},
+		{syscall.SIGQUIT, 3, "dump"},
+	} {
+		t.Run(SignalName(tc.sig), func(t *testing.T) {
+			c, codes := newTestCloser(t, Config{ExitSignals: []os.Signal{syscall.SIGTERM, syscall.SIGQUIT}})
+			ran := make(chan string, 2)
+			c.On(syscall.SIGTERM).Run(func() { ran <- "flush" }).ExitCode(0)
+			c.On(syscall.SIGQUIT).Run(func() { ran <- "dump" }).ExitCode(3)
+			c.SendSignal(tc.sig)
+			if code := waitExit(t, codes); code != tc.code {
+				t.Errorf("exit code %d, want %d", code, tc.code)
+			}
+			close(ran)
+			var got []string
+			for name := range ran {
+				got = append(got, name)
+			}
+			if !reflect.DeepEqual(got, []string{tc.ran}) {
+				t.Errorf("ran %v, want [%s]", got, tc.ran)
+			}
+		})
+	}
+}
+
+func TestSignalBurstBeforeWaiting(t *testing.T) {
+	c, codes := newTestCloser(t, Config{})
+	for i := 0; i < signalBuffer; i++ {
+		c.SendSignal(syscall.SIGTERM)
+	}
+	waitExit(t, codes)
+	if n := c.SignalCounts()[syscall.SIGTERM]; n != 1 {
+		t.Errorf("SIGTERM counted %d times, want once", n)
+	}
+}
+
+func TestObserveOnlyLoggedByDefault(t *testing.T) {
+	c, codes := newTestCloser(t, Config{})
+	var buf bytes.Buffer
+	out := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(out)
+	c.SetObserveOnly(true)
+	c.SendSignal(syscall.SIGTERM)
+	waitForIgnored(t, c, syscall.SIGTERM)
+	log.SetOutput(out)
+	if !strings.Contains(buf.String(), "SIGTERM") {
+		t.Errorf("observed signal not logged, the output is %q", buf.String())
+	}
+	go c.Close()
+	waitExit(t, codes)
+}
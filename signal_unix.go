@@ -0,0 +1,26 @@
+//go:build unix
+
+package closer
+
+import (
+	"os"
+	"syscall"
+)
+
+// sigPIPE is SIGPIPE on the platforms that have it, see IgnoreSIGPIPE.
+var sigPIPE os.Signal = syscall.SIGPIPE
+
+func init() {
+	signalNames[syscall.SIGCHLD] = "SIGCHLD"
+	signalNames[syscall.SIGCONT] = "SIGCONT"
+	signalNames[syscall.SIGSTOP] = "SIGSTOP"
+	signalNames[syscall.SIGTSTP] = "SIGTSTP"
+	signalNames[syscall.SIGTTIN] = "SIGTTIN"
+	signalNames[syscall.SIGTTOU] = "SIGTTOU"
+	signalNames[syscall.SIGURG] = "SIGURG"
+	signalNames[syscall.SIGUSR1] = "SIGUSR1"
+	signalNames[syscall.SIGUSR2] = "SIGUSR2"
+	signalNames[syscall.SIGWINCH] = "SIGWINCH"
+	signalNames[syscall.SIGXCPU] = "SIGXCPU"
+	signalNames[syscall.SIGXFSZ] = "SIGXFSZ"
+}
@@ -0,0 +1,58 @@
+//go:build unix
+
+package closer
+
+import (
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+)
+
+func TestSignalAfterInitRestarts(t *testing.T) {
+	c, codes := newTestCloser(t, Config{})
+	var calls atomic.Int32
+	c.Bind(func() { calls.Add(1) })
+	for i := 0; i < 3; i++ {
+		c.Init(Config{ExitCodeOK: 2, ExitSignals: []os.Signal{syscall.SIGUSR1}})
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	if code := waitExit(t, codes); code != 2 {
+		t.Errorf("exit code %d, want 2", code)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("cleanup called %d times, want once", n)
+	}
+}
+
+func TestSetSignalsChangesWatched(t *testing.T) {
+	c, codes := newTestCloser(t, Config{ExitSignals: []os.Signal{syscall.SIGUSR1}})
+	got := make(chan os.Signal, 1)
+	c.BindSig(func(sig os.Signal) { got <- sig })
+	c.SetSignals(syscall.SIGUSR2)
+	if watched := c.WatchedSignals(); len(watched) != 1 || watched[0] != syscall.SIGUSR2 {
+		t.Fatalf("watched %v, want SIGUSR2", watched)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+	waitExit(t, codes)
+	if sig := <-got; sig != syscall.SIGUSR2 {
+		t.Errorf("shut down by %v, want SIGUSR2", sig)
+	}
+}
+
+func TestSignalRightAfterConstruction(t *testing.T) {
+	c, codes := newTestCloser(t, Config{ExitCodeOK: 2, ExitSignals: []os.Signal{syscall.SIGUSR1}})
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	if code := waitExit(t, codes); code != 2 {
+		t.Errorf("exit code %d, want 2", code)
+	}
+	if sig := c.Snapshot().Signal; sig != "SIGUSR1" {
+		t.Errorf("shut down by %q, want SIGUSR1", sig)
+	}
+}
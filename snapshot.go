@@ -0,0 +1,88 @@
+package closer
+
+// State is a snapshot of the closer for debugging, e.g. to serve on a debug endpoint, see Snapshot.
+type State struct {
+	// Closing tells if the shutdown has started, see IsClosing.
+	Closing bool   `json:"closing"`
+	Cause   string `json:"cause"`
+	Signal  string `json:"signal,omitempty"`
+	// Cleanups are the bound cleanup callbacks in the order they were bound,
+	// once the shutdown has started that's those it runs in the order it does.
+	Cleanups       []CleanupState `json:"cleanups"`
+	WatchedSignals []string       `json:"watched_signals"`
+	SignalCounts   map[string]int `json:"signal_counts"`
+	// Progress is set once the shutdown runs the cleanups.
+	Progress *Progress `json:"progress,omitempty"`
+}
+
+// CleanupState describes a bound cleanup callback.
+type CleanupState struct {
+	Name      string `json:"name,omitempty"`
+	Label     string `json:"label,omitempty"`
+	DependsOn string `json:"depends_on,omitempty"`
+	// Signal is set for the callbacks bound to a signal via BindSignal.
+	Signal  string `json:"signal,omitempty"`
+	Enabled bool   `json:"enabled"`
+}
+
+// Progress is the progress of the cleanups, see ProgressInterval.
+type Progress struct {
+	Done    int    `json:"done"`
+	Total   int    `json:"total"`
+	Current string `json:"current,omitempty"`
+}
+
+// Snapshot returns the state of the closer, nothing in there refers to the closer's own data.
+func Snapshot() State {
+	return std().Snapshot()
+}
+
+// Snapshot is the same as the package-level Snapshot but for this closer.
+func (c *Closer) Snapshot() State {
+	var state State
+	var list []cleanup
+	if c.IsClosing() {
+		// the shutdown holds c.sem while it runs the cleanups
+		c.mux.Lock()
+		list = c.running
+		c.mux.Unlock()
+		if list != nil {
+			state.Progress = &Progress{
+				Done:  int(c.ran.Load()),
+				Total: int(c.total.Load()),
+			}
+			if name := c.current.Load(); name != nil {
+				state.Progress.Current = *name
+			}
+		}
+	} else {
+		c.sem.Lock()
+		list = c.cleanups
+		c.sem.Unlock()
+	}
+	for _, cb := range list {
+		cs := CleanupState{
+			Name:      cb.name,
+			Label:     cb.label(),
+			DependsOn: cb.dependsOn,
+			Enabled:   cb.handle == nil || cb.handle.Enabled(),
+		}
+		if cb.signal != nil {
+			cs.Signal = SignalName(cb.signal)
+		}
+		state.Cleanups = append(state.Cleanups, cs)
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	state.Closing = c.IsClosing()
+	state.WatchedSignals = append([]string(nil), c.watchedNames...)
+	state.Cause = c.cause.String()
+	if c.sig != nil {
+		state.Signal = SignalName(c.sig)
+	}
+	state.SignalCounts = make(map[string]int, len(c.sigCounts))
+	for sig, n := range c.sigCounts {
+		state.SignalCounts[SignalName(sig)] = n
+	}
+	return state
+}
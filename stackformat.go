@@ -0,0 +1,45 @@
+package closer
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// StackFormat defines how the frames of the panic stacktraces are printed.
+type StackFormat int
+
+const (
+	// StackFull prints the full path of the file, the line and the program counter, then the function name
+	// along with the source line, like runtime/debug.Stack used to. That's the default.
+	StackFull StackFormat = iota
+	// StackShort prints the base name of the file and the line alone, as in "closer.go:42".
+	StackShort
+	// StackFunc prints the function name with its package followed by the file and line,
+	// as in "closer.Close (/src/closer/closer.go:42)".
+	StackFunc
+	// StackGoPanic prints the frames the way the Go runtime does for an unrecovered panic,
+	// as in "closer.Close(...)" followed by "/src/closer/closer.go:42 +0x1d".
+	StackGoPanic
+)
+
+// FormatAs returns the frame formatted as f defines, with a trailing newline.
+func (frame *StackFrame) FormatAs(f StackFormat) string {
+	name := frame.Name
+	if len(frame.Package) > 0 {
+		name = frame.Package + "." + frame.Name
+	}
+	switch f {
+	case StackShort:
+		return fmt.Sprintf("%s:%d\n", filepath.Base(frame.File), frame.LineNumber)
+	case StackFunc:
+		return fmt.Sprintf("%s (%s:%d)\n", name, frame.File, frame.LineNumber)
+	case StackGoPanic:
+		var offset uintptr
+		if fn := frame.Func(); fn != nil {
+			offset = frame.ProgramCounter - fn.Entry()
+		}
+		return fmt.Sprintf("%s(...)\n\t%s:%d +0x%x\n", name, frame.File, frame.LineNumber, offset)
+	default:
+		return frame.String()
+	}
+}
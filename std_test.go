@@ -0,0 +1,37 @@
+package closer
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// initCleanup is closed by the callback bound to the default closer from the init below.
+var initCleanup = make(chan struct{})
+
+func init() {
+	Bind(func() { close(initCleanup) })
+}
+
+// TestRunAfterBindFromInit is the only test using the default closer, it shuts it down.
+func TestRunAfterBindFromInit(t *testing.T) {
+	defer func(code int) { ExitCodeErr = code }(ExitCodeErr)
+	ExitCodeErr = 7
+	code := Run(func(context.Context) error { return errors.New("boom") })
+	if code != 7 {
+		t.Errorf("Run = %d, want the ExitCodeErr assigned after the init", code)
+	}
+	waitChan(t, initCleanup, "cleanup bound from init")
+}
+
+func TestBindBeforeInit(t *testing.T) {
+	c, codes := newTestCloser(t, Config{})
+	called := make(chan struct{})
+	c.Bind(func() { close(called) })
+	c.Init(Config{ExitCodeErr: 5})
+	go c.CloseErr(errors.New("boom"))
+	if code := waitExit(t, codes); code != 5 {
+		t.Errorf("exit code %d, want 5", code)
+	}
+	waitChan(t, called, "cleanup bound before Init")
+}